@@ -0,0 +1,169 @@
+package binclude
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// WriteZip writes the file or directory root and everything below it as a zip
+// archive to w, the paths in the archive are relative to root. Modes and
+// modification times are preserved, files which don't compress well are stored.
+// The archive is streamed, only one file is decompressed at a time.
+func (fs *FileSystem) WriteZip(w io.Writer, root string) error {
+	zw := zip.NewWriter(w)
+	if err := fs.writeZip(zw, root); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeZip adds root and everything below it to zw.
+func (fs *FileSystem) writeZip(zw *zip.Writer, root string) error {
+	return fs.writeArchive(root, func(name string, info os.FileInfo, file *File) error {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = name
+		hdr.Modified = archiveTime(info.ModTime())
+		hdr.Method = zip.Store
+		if info.IsDir() {
+			hdr.Name += "/"
+		} else if shouldCompress(name) {
+			hdr.Method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		r, _, err := file.content()
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(fw, r)
+		return err
+	})
+}
+
+// WriteTar writes the file or directory root and everything below it as a tar
+// archive to w, the paths in the archive are relative to root.
+// Modes and modification times are preserved.
+// The archive is streamed, only one file is decompressed at a time.
+func (fs *FileSystem) WriteTar(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+
+	err := fs.writeArchive(root, func(name string, info os.FileInfo, file *File) error {
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = name
+		hdr.ModTime = archiveTime(info.ModTime())
+		if info.IsDir() {
+			hdr.Name += "/"
+			return tw.WriteHeader(hdr)
+		}
+
+		r, size, err := file.content()
+		if err != nil {
+			return err
+		}
+
+		hdr.Size = size
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// writeArchive calls add for root and every file and directory below it in lexical order,
+// name is the path relative to root, the root directory itself is skipped.
+func (fs *FileSystem) writeArchive(root string, add func(name string, info os.FileInfo, file *File) error) error {
+	cleaned, ok := CleanPath(root)
+	if !ok {
+		return &os.PathError{Op: "open", Path: root, Err: os.ErrInvalid}
+	}
+	root = cleaned
+
+	return fs.Walk(root, func(full string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := full
+		switch {
+		case full == root && info.IsDir():
+			return nil
+		case full == root:
+			name = path.Base(full)
+		case root != ".":
+			name = strings.TrimPrefix(full, root+"/")
+		}
+
+		file, ok := fs.file(full)
+		if !ok {
+			return &os.PathError{Op: "open", Path: full, Err: os.ErrNotExist}
+		}
+
+		return add(name, info, file)
+	})
+}
+
+// content returns a reader of the decompressed content and its size.
+func (f *File) content() (io.Reader, int64, error) {
+	if err := f.load(); err != nil {
+		return nil, 0, err
+	}
+
+	if f.Compression != Gzip {
+		return bytes.NewReader(f.Content), int64(len(f.Content)), nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(f.Content))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// gzip only stores the size modulo 2^32, so the content is decompressed twice
+	size, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.Reset(bytes.NewReader(f.Content)); err != nil {
+		return nil, 0, err
+	}
+
+	return r, size, nil
+}
+
+// archiveTime returns the unix epoch for the zero time, which can't be stored in archives.
+func archiveTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0)
+	}
+
+	return t
+}
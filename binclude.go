@@ -8,7 +8,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -25,6 +27,12 @@ var Debug = false
 // This function returns the name to make it usable in global variable definitions.
 func Include(name string) string { return name }
 
+// IncludeAs like Include but the file/ directory is available under target
+// instead of its path relative to the package (noop).
+// Missing parent directories of target are created.
+// This function returns target to make it usable in global variable definitions.
+func IncludeAs(name, target string) string { return target }
+
 // IncludeGlob include all files matching the given pattern
 // same syntax as filepath.Glob
 // This function returns an empty string to make it usable in global variable definitions.
@@ -34,10 +42,67 @@ func IncludeGlob(pattern string) string { return "" }
 // Paths are separated by a newline (noop)
 func IncludeFromFile(name string) {}
 
+// IncludeModule like Include but name is relative to the root of the module modPath,
+// which has to be required by the go.mod of the package (noop).
+// The files are available under modPath joined with name,
+// the version of the module is recorded in the generated file.
+// This function returns the path in the FileSystem to make it usable in global variable definitions.
+func IncludeModule(modPath, name string) string { return path.Join(modPath, name) }
+
+// IncludeURL include the file at the http, https or file url (noop).
+// The file is fetched by the generator, verified against the hex encoded sha256 hash
+// and cached, if sha256 is empty the hash is pinned in the binclude.lock file.
+// The file is available under the last element of the url path.
+// This function returns the path in the FileSystem to make it usable in global variable definitions.
+func IncludeURL(rawurl, sha256 string) string {
+	if u, err := url.Parse(rawurl); err == nil {
+		rawurl = u.Path
+		if u.Opaque != "" {
+			rawurl = u.Opaque
+		}
+	}
+
+	return path.Base(rawurl)
+}
+
+// IncludeCommand include the output of a command (noop).
+// The command is run by the generator in the package directory before the files
+// are included, so its output files can be included by the other Include functions.
+// The stdout of the command is available under the command line with every character
+// except letters, digits, '.', '-' and '_' replaced by '_', e.g. "git_describe_--tags".
+// This function returns the path in the FileSystem to make it usable in global variable definitions.
+func IncludeCommand(name string, args ...string) string {
+	parts := append([]string{path.Base(filepath.ToSlash(name))}, args...)
+
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "_"))
+
+	if key = strings.Trim(key, "."); key == "" {
+		return "_"
+	}
+
+	return key
+}
+
+// IncludeArchive include the files in the zip, tar, tar.gz or tar.zst archive (noop).
+// The archive is unpacked by the generator, the files are available under prefix
+// with the modes and modification times stored in the archive.
+// This function returns prefix to make it usable in global variable definitions.
+func IncludeArchive(name, prefix string) string { return prefix }
+
 // FileSystem implements access to a collection of named files.
 type FileSystem struct {
 	Files
 	sync.RWMutex
+
+	index   map[string][]string // directory -> sorted names of the entries
+	indexed int                 // len(Files) when index was built
+	indexMu sync.Mutex
 }
 
 // check that the http.FileSystem interface is implemented
@@ -46,23 +111,140 @@ var _ http.FileSystem = new(FileSystem)
 // Files a map from the filepath to the files
 type Files map[string]*File
 
-// Open returns a File using the File interface
+// Open returns a File using the File interface.
+// The name is cleaned by CleanPath, names pointing outside
+// of the FileSystem are rejected with os.ErrInvalid.
 func (fs *FileSystem) Open(name string) (http.File, error) {
+	cleaned, ok := CleanPath(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrInvalid}
+	}
+
 	if Debug {
-		name = filepath.FromSlash(name)
+		return os.Open(filepath.FromSlash(cleaned))
+	}
+
+	if f, ok := fs.file(cleaned); ok {
+		file := *f // every opened File has its own reader and Readdir position
+		if f.lazy != nil {
+			file.reader = &lazyReader{file: &file}
+		} else {
+			file.reader = bytes.NewReader(f.Content)
+		}
+		file.path = cleaned
+		file.fs = fs
+		return &file, nil
+	}
 
-		return os.Open(name)
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// CleanPath returns the key used in Files for name.
+// Backslashes are treated as separators, leading slashes are removed
+// and the result is cleaned with path.Clean, the root directory is ".".
+// CleanPath returns false if name points outside of the FileSystem.
+//
+//	"/assets/a.txt", "./assets//a.txt", "assets/../assets/a.txt", `assets\a.txt` -> "assets/a.txt"
+//	"../a.txt", "/../a.txt" -> false
+func CleanPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Clean(strings.TrimLeft(name, "/"))
+
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
 	}
 
-	name = strings.TrimPrefix(name, "./")
+	return name, true
+}
+
+// file returns the File at name, directories which only exist implicitly,
+// like the root directory ".", are synthesized from the directory index.
+func (fs *FileSystem) file(name string) (*File, bool) {
 	if f, ok := fs.Files[name]; ok {
-		f.reader = bytes.NewReader(f.Content)
-		f.path = name
-		f.fs = fs
-		return f, nil
+		return f, true
+	}
+
+	if _, ok := fs.dirIndex()[name]; !ok {
+		return nil, false
+	}
+
+	return &File{
+		Filename: path.Base(name),
+		Mode:     os.ModeDir | os.ModePerm,
+	}, true
+}
+
+// Reindex rebuilds the index of the directories used by Readdir and to find
+// directories which only exist implicitly. It has to be called after files were
+// added to or removed from Files, the generated code calls it in init.
+func (fs *FileSystem) Reindex() {
+	fs.indexMu.Lock()
+	fs.buildIndex()
+	fs.indexMu.Unlock()
+}
+
+// dirIndex returns a map from every directory to the sorted names of its entries.
+// The index is built on first use unless Reindex was called, it is rebuilt if
+// the number of files changes or a file in it was missing.
+func (fs *FileSystem) dirIndex() map[string][]string {
+	fs.indexMu.Lock()
+	defer fs.indexMu.Unlock()
+
+	if fs.index == nil || fs.indexed != len(fs.Files) {
+		fs.buildIndex()
 	}
 
-	return nil, &os.PathError{"open", name, errors.New("File does not exist in binclude map")}
+	return fs.index
+}
+
+// buildIndex builds the directory index, fs.indexMu has to be held.
+func (fs *FileSystem) buildIndex() {
+
+	index := map[string][]string{".": nil}
+	for name := range fs.Files {
+		// add name and all its missing parents to the index
+		for name != "." {
+			dir := path.Dir(name)
+			_, known := index[dir]
+			index[dir] = append(index[dir], path.Base(name))
+			if known {
+				break
+			}
+			name = dir
+		}
+	}
+
+	for dir, names := range index {
+		sort.Strings(names)
+		index[dir] = dedup(names)
+	}
+
+	fs.index = index
+	fs.indexed = len(fs.Files)
+}
+
+// invalidateIndex discards the directory index, it is rebuilt on the next use.
+func (fs *FileSystem) invalidateIndex() {
+	fs.indexMu.Lock()
+	fs.index = nil
+	fs.indexMu.Unlock()
+}
+
+// dedup removes consecutive duplicates from a sorted slice.
+func dedup(names []string) []string {
+	if len(names) == 0 {
+		return names
+	}
+
+	n := 1
+	for _, name := range names[1:] {
+		if name != names[n-1] {
+			names[n] = name
+			n++
+		}
+	}
+
+	return names[:n]
 }
 
 // Stat returns a FileInfo describing the named file.
@@ -104,6 +286,161 @@ func (fs *FileSystem) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return list, nil
 }
 
+// Glob returns the names of all files matching pattern in lexical order.
+// The pattern syntax is the same as in Match.
+// The only possible returned error is path.ErrBadPattern.
+func (fs *FileSystem) Glob(pattern string) ([]string, error) {
+	patternElems, err := splitPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.RLock()
+	defer fs.RUnlock()
+
+	var matches []string
+	for name := range fs.Files {
+		if name == "." {
+			continue
+		}
+
+		if matchElems(patternElems, strings.Split(name, "/")) {
+			matches = append(matches, name)
+		}
+	}
+
+	sort.Strings(matches)
+
+	return matches, nil
+}
+
+// Match reports whether name matches the shell pattern.
+// The pattern syntax is the same as in path.Match, additionally
+// a "**" path element matches zero or more directories.
+// The only possible returned error is path.ErrBadPattern.
+func Match(pattern, name string) (bool, error) {
+	patternElems, err := splitPattern(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return matchElems(patternElems, strings.Split(strings.TrimPrefix(name, "./"), "/")), nil
+}
+
+// splitPattern splits pattern into its path elements and validates them.
+func splitPattern(pattern string) ([]string, error) {
+	patternElems := strings.Split(strings.TrimPrefix(pattern, "./"), "/")
+	for _, elem := range patternElems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return patternElems, nil
+}
+
+// matchElems reports whether the path elements match the pattern elements,
+// the pattern elements are already validated.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// Walk walks the file tree rooted at root, calling walkFn for each file or
+// directory in the tree, including root. The files are walked in lexical order.
+// Walk has the same semantics as filepath.Walk including filepath.SkipDir,
+// the paths passed to walkFn are separated by slashes.
+func (fs *FileSystem) Walk(root string, walkFn filepath.WalkFunc) error {
+	info, err := fs.Stat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = fs.walk(root, info, walkFn)
+	}
+
+	if err == filepath.SkipDir {
+		return nil
+	}
+
+	return err
+}
+
+// walk recursively descends name, calling walkFn.
+func (fs *FileSystem) walk(name string, info os.FileInfo, walkFn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return walkFn(name, info, nil)
+	}
+
+	infos, err := fs.ReadDir(name)
+	err1 := walkFn(name, info, err)
+	// If err != nil, walk can't walk into this directory.
+	// err1 != nil means walkFn want walk to skip this directory or stop walking.
+	// Therefore, if one of err and err1 isn't nil, walk will return.
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	for _, info := range infos {
+		err = fs.walk(path.Join(name, info.Name()), info, walkFn)
+		if err != nil && (!info.IsDir() || err != filepath.SkipDir) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sub returns a FileSystem rooted at dir, which contains all files below dir.
+// The files are shared with fs, but files added to fs afterwards
+// are not visible in the returned FileSystem.
+func (fs *FileSystem) Sub(dir string) (*FileSystem, error) {
+	info, err := fs.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "sub", Path: dir, Err: errors.New("not a directory")}
+	}
+
+	dir, _ = CleanPath(dir) // Stat already rejected invalid paths
+
+	fs.RLock()
+	defer fs.RUnlock()
+
+	sub := &FileSystem{Files: make(Files)}
+	for name, file := range fs.Files {
+		switch {
+		case dir == ".":
+			sub.Files[name] = file
+		case strings.HasPrefix(name, dir+"/"):
+			sub.Files[strings.TrimPrefix(name, dir+"/")] = file
+		}
+	}
+
+	return sub, nil
+}
+
 // CopyFile copies a specific file from a binclude FileSystem to the hosts FileSystem.
 // Permissions are copied from the included file.
 func (fs *FileSystem) CopyFile(bincludePath, hostPath string) error {
@@ -171,15 +508,20 @@ func (fs *FileSystem) Decompress() (err error) {
 
 }
 
-// Compress turns a FileSystem without compressed files into a filesystem with compressed files
+// Compress turns a FileSystem without compressed files into a filesystem with compressed files,
+// files which are already compressed are left as they are
 func (fs *FileSystem) Compress(algo Compression) error {
 	if algo == None {
 		return nil
 	}
 	for _, file := range fs.Files {
-		if file.Mode.IsDir() || !shouldCompress(file.Filename) {
+		if file.Mode.IsDir() || file.Compression != None || !shouldCompress(file.Filename) {
 			continue
 		}
+		if err := file.load(); err != nil {
+			return err
+		}
+
 		var b bytes.Buffer
 
 		var writer io.WriteCloser
@@ -195,6 +537,7 @@ func (fs *FileSystem) Compress(algo Compression) error {
 
 		file.Compression = algo
 		file.Content = b.Bytes()
+		file.lazy = nil
 	}
 
 	return nil
@@ -204,6 +547,12 @@ func (fs *FileSystem) Compress(algo Compression) error {
 // inspired by https://github.com/gin-contrib/gzip/blob/master/options.go
 var compressExcl = []string{".jpg", ".jpeg", ".gz", ".png", ".gif", ".zip"}
 
+// ShouldCompress reports whether Compress compresses a file named name,
+// files which don't compress well like images and archives are skipped
+func ShouldCompress(name string) bool {
+	return shouldCompress(name)
+}
+
 // shouldCompress says whether a file should be compressed based on its mimetype
 func shouldCompress(name string) bool {
 	for _, excl := range compressExcl {
@@ -224,6 +573,8 @@ type File struct {
 	reader io.ReadSeeker
 	path   string
 	fs     *FileSystem
+	dirPos int
+	lazy   *lazyContent
 }
 
 // check that the http.File interface is implemented
@@ -250,30 +601,76 @@ func (f *File) Close() error {
 // The returned value is always the same and is not affected by calls
 // to any other method.
 func (f *File) Size() int64 {
+	if f.lazy != nil {
+		return int64(f.lazy.zf.UncompressedSize64)
+	}
+
 	return int64(len(f.Content))
 }
 
 // Readdir reads the contents of the directory associated with file and
 // returns a slice of up to n FileInfo values, as would be returned
-// by Lstat, in directory order. Subsequent calls on the same file will yield
+// by Lstat, in lexical order. Subsequent calls on the same file will yield
 // further FileInfos.
+//
+// If n > 0, Readdir returns at most n FileInfo structures. In this case, if
+// Readdir returns an empty slice, it will return io.EOF.
+//
+// If n <= 0, Readdir returns all the remaining FileInfo from the directory
+// in a single slice.
+//
+// If the file is not a directory the contents of its parent directory are returned.
 func (f *File) Readdir(count int) (infos []os.FileInfo, err error) {
-	fileDir := f.Name()
+	dir := f.path
 	if !f.Mode.IsDir() {
-		fileDir = filepath.Dir(f.path)
+		dir = path.Dir(f.path)
+	}
+
+	pos := f.dirPos
+	infos, missing := f.readdir(dir, count)
+	if missing {
+		// a listed file was removed from Files after the index was built
+		f.fs.invalidateIndex()
+		f.dirPos = pos
+		infos, _ = f.readdir(dir, count)
 	}
 
-	for path, file := range f.fs.Files {
-		if filepath.Dir(path) != fileDir {
+	if count > 0 && len(infos) == 0 {
+		return nil, io.EOF
+	}
+
+	return infos, nil
+}
+
+// readdir returns up to count entries of dir after f.dirPos,
+// entries in the index which don't exist anymore are skipped and reported.
+func (f *File) readdir(dir string, count int) (infos []os.FileInfo, missing bool) {
+	names := f.fs.dirIndex()[dir]
+	if f.dirPos < len(names) {
+		names = names[f.dirPos:]
+	} else {
+		names = nil
+	}
+
+	if count > 0 && len(names) > count {
+		names = names[:count]
+	}
+
+	f.dirPos += len(names)
+
+	infos = make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		file, ok := f.fs.file(path.Join(dir, name))
+		if !ok {
+			missing = true
 			continue
 		}
 
 		info, _ := file.Stat()
-
 		infos = append(infos, info)
 	}
 
-	return infos, nil
+	return infos, missing
 }
 
 // Stat returns the FileInfo structure describing file.
@@ -1,10 +1,19 @@
 package binclude_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lu4p/binclude"
 	"github.com/lu4p/binclude/example"
@@ -57,6 +66,64 @@ func ExampleIncludeGlob() {
 	// Output: asset1
 }
 
+func ExampleFileSystem_Glob() {
+	matches, _ := BinFS.Glob("assets/**/*.txt")
+	for _, match := range matches {
+		fmt.Println(match)
+	}
+	// Output: assets/asset1.txt
+	// assets/asset2.txt
+	// assets/subdir/subdirasset1.txt
+	// assets/subdir/subdirasset2.txt
+}
+
+func ExampleFileSystem_Walk() {
+	BinFS.Walk("assets", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(path, info.IsDir())
+		return nil
+	})
+	// Output: assets true
+	// assets/asset1.txt false
+	// assets/asset2.txt false
+	// assets/logo_nocompress.png false
+	// assets/subdir true
+	// assets/subdir/subdirasset1.txt false
+	// assets/subdir/subdirasset2.txt false
+}
+
+func ExampleFileSystem_Sub() {
+	sub, _ := BinFS.Sub("assets/subdir")
+	data, _ := sub.ReadFile("subdirasset1.txt")
+	fmt.Println(string(data))
+	// Output: subdirasset1
+}
+
+func ExampleUnion() {
+	other := &binclude.FileSystem{Files: binclude.Files{
+		"app.js": {Filename: "app.js", Mode: 0o644, Content: []byte("app")},
+	}}
+
+	var union binclude.Union
+	union.Mount("/", BinFS)
+	union.Mount("/static/js", other)
+
+	infos, _ := union.ReadDir("/")
+	for _, info := range infos {
+		fmt.Println(info.Name())
+	}
+
+	data, _ := union.ReadFile("/static/js/app.js")
+	fmt.Println(string(data))
+	// Output: assets
+	// file.txt
+	// static
+	// app
+}
+
 func TestCopyFile(t *testing.T) {
 	err := BinFS.CopyFile("./assets/asset1.txt", "asset1.txt")
 	if err != nil {
@@ -225,3 +292,647 @@ func TestFileInfo(t *testing.T) {
 		t.Fatal("Sys return should be nil")
 	}
 }
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.txt", []string{"file.txt"}},
+		{"./assets/*.txt", []string{"assets/asset1.txt", "assets/asset2.txt"}},
+		{"assets/*", []string{"assets/asset1.txt", "assets/asset2.txt", "assets/logo_nocompress.png", "assets/subdir"}},
+		{"**/subdir", []string{"assets/subdir"}},
+		{"**/*.png", []string{"assets/logo_nocompress.png"}},
+		{"assets/**", []string{"assets", "assets/asset1.txt", "assets/asset2.txt", "assets/logo_nocompress.png",
+			"assets/subdir", "assets/subdir/subdirasset1.txt", "assets/subdir/subdirasset2.txt"}},
+		{"assets/**/subdir/*1.txt", []string{"assets/subdir/subdirasset1.txt"}},
+		{"nonexistent/**", nil},
+	}
+
+	for _, test := range tests {
+		matches, err := BinFS.Glob(test.pattern)
+		if err != nil {
+			t.Fatal(test.pattern, err)
+		}
+
+		if !reflect.DeepEqual(matches, test.want) {
+			t.Fatalf("%s: got %v want %v", test.pattern, matches, test.want)
+		}
+	}
+
+	_, err := BinFS.Glob("assets/[")
+	if err == nil {
+		t.Fatal("bad pattern was accepted")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	var paths []string
+	err := BinFS.Walk("./assets", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Name() == "subdir" {
+			return filepath.SkipDir
+		}
+
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"./assets", "assets/asset1.txt", "assets/asset2.txt", "assets/logo_nocompress.png"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v want %v", paths, want)
+	}
+
+	err = BinFS.Walk("nonexistent", func(path string, info os.FileInfo, err error) error {
+		return err
+	})
+	if err == nil {
+		t.Fatal("can walk nonexistent directory")
+	}
+}
+
+func TestReaddir(t *testing.T) {
+	f, err := BinFS.Open("assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var names []string
+	for {
+		infos, err := f.Readdir(3)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(infos) == 0 || len(infos) > 3 {
+			t.Fatal("unexpected number of entries:", len(infos))
+		}
+
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+	}
+
+	want := []string{"asset1.txt", "asset2.txt", "logo_nocompress.png", "subdir"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v want %v", names, want)
+	}
+
+	infos, err := f.Readdir(-1)
+	if err != nil || len(infos) != 0 {
+		t.Fatal("Readdir(-1) after io.EOF should return no entries:", infos, err)
+	}
+}
+
+func TestReadDirRoot(t *testing.T) {
+	for _, root := range []string{".", "/", "./"} {
+		infos, err := BinFS.ReadDir(root)
+		if err != nil {
+			t.Fatal(root, err)
+		}
+
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+
+		want := []string{"assets", "file.txt"}
+		if !reflect.DeepEqual(names, want) {
+			t.Fatalf("%s: got %v want %v", root, names, want)
+		}
+	}
+
+	fs := &binclude.FileSystem{Files: binclude.Files{
+		"a/b/c.txt": {Filename: "c.txt", Mode: 0o644},
+	}}
+
+	for dir, want := range map[string]string{".": "a", "a": "b", "a/b": "c.txt"} {
+		infos, err := fs.ReadDir(dir)
+		if err != nil {
+			t.Fatal(dir, err)
+		}
+
+		if len(infos) != 1 || infos[0].Name() != want {
+			t.Fatalf("%s: got %v want %v", dir, infos, want)
+		}
+	}
+}
+
+func TestReadDirModifiedFiles(t *testing.T) {
+	fs := &binclude.FileSystem{Files: binclude.Files{
+		"a.txt":   {Filename: "a.txt", Mode: 0o644},
+		"b.txt":   {Filename: "b.txt", Mode: 0o644},
+		"x/y.txt": {Filename: "y.txt", Mode: 0o644},
+	}}
+
+	readDir := func(dir string) []string {
+		infos, err := fs.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+
+	readDir(".")
+
+	// same number of files, a listed file is missing
+	delete(fs.Files, "a.txt")
+	fs.Files["c.txt"] = &binclude.File{Filename: "c.txt", Mode: 0o644}
+
+	if got, want := readDir("."), []string{"b.txt", "c.txt", "x"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+
+	// same number of files, nothing listed is missing, so Reindex is required
+	delete(fs.Files, "x/y.txt")
+	fs.Files["d/e.txt"] = &binclude.File{Filename: "e.txt", Mode: 0o644}
+	fs.Reindex()
+
+	if got, want := readDir("."), []string{"b.txt", "c.txt", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+
+	if _, err := fs.Stat("x"); !os.IsNotExist(err) {
+		t.Error("removed implicit directory still exists:", err)
+	}
+
+	if info, err := fs.Stat("d"); err != nil || !info.IsDir() {
+		t.Error("implicit directory of an added file doesn't exist:", err)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"file.txt", "file.txt", true},
+		{"./file.txt", "file.txt", true},
+		{"/file.txt", "file.txt", true},
+		{"//file.txt", "file.txt", true},
+		{"/assets/asset1.txt", "assets/asset1.txt", true},
+		{"assets//asset1.txt", "assets/asset1.txt", true},
+		{"assets/./asset1.txt", "assets/asset1.txt", true},
+		{"assets/../assets/asset1.txt", "assets/asset1.txt", true},
+		{"assets\\asset1.txt", "assets/asset1.txt", true},
+		{".\\assets\\subdir\\", "assets/subdir", true},
+		{"assets/", "assets", true},
+		{"", ".", true},
+		{".", ".", true},
+		{"/", ".", true},
+		{"./", ".", true},
+		{"assets/..", ".", true},
+		{"..", "", false},
+		{"../file.txt", "", false},
+		{"/../file.txt", "", false},
+		{"assets/../../file.txt", "", false},
+		{"..\\file.txt", "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := binclude.CleanPath(test.name)
+		if got != test.want || ok != test.ok {
+			t.Errorf("CleanPath(%q) = %q, %v want %q, %v", test.name, got, ok, test.want, test.ok)
+		}
+
+		_, err := BinFS.Stat(test.name)
+		if test.ok && err != nil {
+			t.Errorf("Stat(%q): %v", test.name, err)
+		}
+
+		if !test.ok && !os.IsNotExist(err) && err == nil {
+			t.Errorf("Stat(%q) should fail", test.name)
+		}
+	}
+
+	_, err := BinFS.ReadFile("/../file.txt")
+	if err == nil {
+		t.Fatal("can read file outside of the FileSystem")
+	}
+
+	content, err := BinFS.ReadFile("/assets\\subdir//../asset1.txt")
+	if err != nil || string(content) != "asset1" {
+		t.Fatal("cannot read file with unclean path:", err)
+	}
+}
+
+func TestIncludeKeys(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{binclude.IncludeModule("example.com/assets", "./fonts"), "example.com/assets/fonts"},
+		{binclude.IncludeURL("https://example.com/js/lib.min.js?v=2", ""), "lib.min.js"},
+		{binclude.IncludeURL("file:assets/a.txt", ""), "a.txt"},
+		{binclude.IncludeCommand("git", "describe", "--tags"), "git_describe_--tags"},
+		{binclude.IncludeCommand("./scripts/build.sh", "a b/c"), "build.sh_a_b_c"},
+	}
+
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("got %q want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestSub(t *testing.T) {
+	sub, err := BinFS.Sub("./assets/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sub.Stat("subdir/subdirasset1.txt")
+	if err != nil {
+		t.Fatal("cannot stat file in sub FileSystem", err)
+	}
+
+	_, err = sub.Stat("file.txt")
+	if err == nil {
+		t.Fatal("file outside of sub FileSystem is visible")
+	}
+
+	root, err := BinFS.Sub(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(root.Files) != len(BinFS.Files) {
+		t.Fatal("sub FileSystem of the root should contain all files")
+	}
+
+	_, err = BinFS.Sub("file.txt")
+	if err == nil {
+		t.Fatal("can create sub FileSystem of a file")
+	}
+
+	_, err = BinFS.Sub("nonexistent")
+	if err == nil {
+		t.Fatal("can create sub FileSystem of nonexistent directory")
+	}
+}
+
+func TestUnion(t *testing.T) {
+	file := func(name, content string) *binclude.File {
+		return &binclude.File{Filename: name, Mode: 0o644, Content: []byte(content)}
+	}
+	dir := func(name string) *binclude.File {
+		return &binclude.File{Filename: name, Mode: os.ModeDir | 0o755}
+	}
+
+	first := &binclude.FileSystem{Files: binclude.Files{
+		"index.html":   file("index.html", "first"),
+		"js":           dir("js"),
+		"js/app.js":    file("app.js", "first"),
+		"css":          dir("css"),
+		"css/main.css": file("main.css", "first"),
+	}}
+	second := &binclude.FileSystem{Files: binclude.Files{
+		"index.html": file("index.html", "second"),
+		"robots.txt": file("robots.txt", "second"),
+		"css":        file("css", "second"),
+	}}
+	third := &binclude.FileSystem{Files: binclude.Files{
+		"app.js": file("app.js", "third"),
+	}}
+
+	var union binclude.Union
+	for _, m := range []struct {
+		prefix string
+		fs     *binclude.FileSystem
+	}{{".", first}, {"/", second}, {"js", third}} {
+		if err := union.Mount(m.prefix, m.fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name, want string
+	}{
+		{"index.html", "first"},    // equal prefixes, the first mount wins
+		{"robots.txt", "second"},   // files from all mounts are visible
+		{"js/app.js", "third"},     // longer prefix wins
+		{"/css/main.css", "first"}, // directories are merged
+		{"css", ""},                // the directory wins because it was mounted first
+	}
+
+	for _, test := range tests {
+		content, err := union.ReadFile(test.name)
+		if err != nil {
+			info, statErr := union.Stat(test.name)
+			if test.want != "" || statErr != nil || !info.IsDir() {
+				t.Fatal(test.name, err)
+			}
+			continue
+		}
+
+		if string(content) != test.want {
+			t.Fatalf("%s: got %q want %q", test.name, content, test.want)
+		}
+	}
+
+	infos, err := union.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+
+	want := []string{"css", "index.html", "js", "robots.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v want %v", names, want)
+	}
+
+	err = union.Mount("../outside", third)
+	if err == nil {
+		t.Fatal("can mount outside of the Union")
+	}
+
+	// a file with a higher priority hides a whole directory
+	var hidden binclude.Union
+	hidden.Mount(".", second)
+	hidden.Mount(".", first)
+
+	_, err = hidden.Stat("css/main.css")
+	if err == nil {
+		t.Fatal("file in hidden directory is visible")
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	fs := &binclude.FileSystem{Files: binclude.Files{
+		"docs":              {Filename: "docs", Mode: os.ModeDir | 0o755, ModTime: modTime},
+		"docs/index.html":   {Filename: "index.html", Mode: 0o644, ModTime: modTime, Content: []byte(strings.Repeat("docs ", 100))},
+		"docs/img/logo.png": {Filename: "logo.png", Mode: 0o600, ModTime: modTime, Content: []byte("png")},
+		"docs/run.sh":       {Filename: "run.sh", Mode: 0o755, ModTime: modTime, Content: []byte("#!/bin/sh")},
+		"other.txt":         {Filename: "other.txt", Mode: 0o644, ModTime: modTime, Content: []byte("other")},
+	}}
+
+	if err := fs.Compress(binclude.Gzip); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"img/":         "",
+		"img/logo.png": "png",
+		"index.html":   strings.Repeat("docs ", 100),
+		"run.sh":       "#!/bin/sh",
+	}
+
+	check := func(format string, got map[string]string, modes map[string]os.FileMode, times map[string]time.Time) {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v want %v", format, got, want)
+		}
+
+		if modes["run.sh"] != 0o755 || modes["img/logo.png"] != 0o600 || !modes["img/"].IsDir() {
+			t.Errorf("%s: modes are not preserved: %v", format, modes)
+		}
+
+		if !times["run.sh"].Equal(modTime) {
+			t.Errorf("%s: mod time is not preserved: %v", format, times["run.sh"])
+		}
+	}
+
+	var b bytes.Buffer
+	if err := fs.WriteZip(&b, "/docs/"); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, modes, times := make(map[string]string), make(map[string]os.FileMode), make(map[string]time.Time)
+	for _, f := range zr.File {
+		if f.Name == "img/logo.png" && f.Method != zip.Store {
+			t.Error("zip: png is compressed")
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got[f.Name], modes[f.Name], times[f.Name] = string(content), f.Mode(), f.Modified
+	}
+	check("zip", got, modes, times)
+
+	b.Reset()
+	if err := fs.WriteTar(&b, "docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, modes, times = make(map[string]string), make(map[string]os.FileMode), make(map[string]time.Time)
+	tr := tar.NewReader(&b)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got[hdr.Name], modes[hdr.Name], times[hdr.Name] = string(content), hdr.FileInfo().Mode(), hdr.ModTime
+	}
+	check("tar", got, modes, times)
+
+	b.Reset()
+	if err := fs.WriteTar(&b, "other.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	hdr, err := tar.NewReader(&b).Next()
+	if err != nil || hdr.Name != "other.txt" {
+		t.Fatal("single file archive:", hdr, err)
+	}
+
+	if err := fs.WriteZip(ioutil.Discard, "../docs"); err == nil {
+		t.Fatal("path outside of the FileSystem was accepted")
+	}
+}
+
+func TestWriteTarLargeFile(t *testing.T) {
+	if testing.Short() || raceEnabled {
+		t.Skip("decompresses more than 4 GiB")
+	}
+
+	// concatenated gzip members of 1 MiB, the size in the last member is only 1 MiB
+	var member bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&member, gzip.BestCompression)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	const members = 4<<10 + 1
+	fs := &binclude.FileSystem{Files: binclude.Files{
+		"large.bin": {Filename: "large.bin", Mode: 0o644, Compression: binclude.Gzip, Content: bytes.Repeat(member.Bytes(), members)},
+	}}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(fs.WriteTar(pw, "."))
+	}()
+
+	tr := tar.NewReader(pr)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := int64(members) << 20; hdr.Size != want {
+		t.Errorf("got size %d want %d", hdr.Size, want)
+	}
+
+	if _, err := io.Copy(ioutil.Discard, pr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenZip(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	fs := &binclude.FileSystem{Files: binclude.Files{
+		"assets":         {Filename: "assets", Mode: os.ModeDir | 0o755, ModTime: modTime},
+		"assets/a.txt":   {Filename: "a.txt", Mode: 0o644, ModTime: modTime, Content: []byte(strings.Repeat("a", 1000))},
+		"assets/run.sh":  {Filename: "run.sh", Mode: 0o755, ModTime: modTime, Content: []byte("#!/bin/sh")},
+		"assets/img.png": {Filename: "img.png", Mode: 0o644, ModTime: modTime, Content: []byte("png")},
+	}}
+
+	if err := fs.Compress(binclude.Gzip); err != nil {
+		t.Fatal(err)
+	}
+
+	exe := filepath.Join(t.TempDir(), "exe")
+	if err := ioutil.WriteFile(exe, []byte("not really an executable"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := binclude.OpenZip(exe); err == nil {
+		t.Error("no error for a file without a zip archive")
+	}
+
+	if err := fs.AppendZip(exe); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("not really an executable")) {
+		t.Error("executable was overwritten")
+	}
+
+	if err := fs.AppendZip(exe); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(again, data) {
+		t.Errorf("appending again didn't replace the archive, got %d bytes want %d", len(again), len(data))
+	}
+
+	var archive bytes.Buffer
+	if err := fs.WriteZip(&archive, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	other := filepath.Join(t.TempDir(), "other.zip")
+	if err := ioutil.WriteFile(other, archive.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.AppendZip(other); err == nil {
+		t.Error("no error for a file with another zip archive")
+	}
+
+	zipFS, err := binclude.OpenZip(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := zipFS.Stat("assets/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 1000 || !info.ModTime().Equal(modTime) {
+		t.Errorf("got size %d and mod time %v", info.Size(), info.ModTime())
+	}
+
+	content, err := zipFS.ReadFile("/assets/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != strings.Repeat("a", 1000) {
+		t.Errorf("got content %q", content)
+	}
+
+	infos, err := zipFS.ReadDir("assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+		if info.Name() == "run.sh" && info.Mode() != 0o755 {
+			t.Errorf("mode of run.sh is not preserved: %v", info.Mode())
+		}
+	}
+
+	if want := []string{"a.txt", "img.png", "run.sh"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v want %v", names, want)
+	}
+
+	// the content is read on first use, without the archive only reading fails
+	if err := os.Truncate(exe, int64(len("not really an executable"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := zipFS.Stat("assets/run.sh"); err != nil {
+		t.Errorf("stat read the content: %v", err)
+	}
+
+	if _, err := zipFS.ReadFile("assets/run.sh"); err == nil {
+		t.Error("no error reading a removed archive")
+	}
+}
@@ -0,0 +1,61 @@
+package bincludegen
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/lu4p/binclude"
+)
+
+// Append includes the files like Generate, but instead of generating go code it appends
+// them as a zip archive to the executable exe, which reads them with binclude.OpenExecutable.
+// The files for the target platform $GOOS/$GOARCH of the executable are appended
+// together with the files without build tag, an archive appended before is replaced.
+// Options.Incremental and Options.Stream are ignored.
+func Append(ctx context.Context, opts Options, exe string) error {
+	opts.Incremental = false
+	opts.Stream = false
+
+	res, err := Generate(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	goos, goarch := os.Getenv("GOOS"), os.Getenv("GOARCH")
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+
+	fs := &binclude.FileSystem{Files: make(binclude.Files)}
+	for _, buildTag := range []string{"default", "_" + goarch, "_" + goos, "_" + goos + "_" + goarch} {
+		if platformFS, ok := res.fileSystems[buildTag]; ok {
+			for path, file := range platformFS.Files {
+				fs.Files[path] = file
+			}
+		}
+	}
+
+	return fs.AppendZip(exe)
+}
+
+// appendMain implements `binclude append <executable>`.
+func appendMain(cfg *Config, jobs int, args []string) int {
+	if len(args) != 1 {
+		log.Println("failed:", errors.New("usage: binclude [flags] append <executable>"))
+		return 2
+	}
+
+	opts := Options{Dir: ".", Config: cfg, Jobs: jobs}
+	if err := Append(context.Background(), opts, args[0]); err != nil {
+		log.Println("failed:", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,152 @@
+package bincludegen
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/lu4p/binclude"
+)
+
+// archiveEntry a file or directory in an archive.
+type archiveEntry struct {
+	name string
+	info os.FileInfo
+	data []byte
+}
+
+// readArchive reads all files and directories of the zip, tar, tar.gz
+// or tar.zst archive at path into memory, the format is detected by
+// the file extension. Symlinks and other special files are skipped.
+// The names are cleaned and names pointing outside of the archive are rejected.
+func readArchive(path string) ([]archiveEntry, error) {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return readZip(path)
+	case strings.HasSuffix(name, ".tar"):
+		return readTar(path, nil)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return readTar(path, func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		})
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return readTar(path, func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		})
+	}
+
+	return nil, errors.New("unsupported archive format, expected .zip, .tar, .tar.gz or .tar.zst: " + path)
+}
+
+func readZip(path string) ([]archiveEntry, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entries []archiveEntry
+	for _, f := range r.File {
+		info := f.FileInfo()
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			continue
+		}
+
+		name, err := archiveName(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := archiveEntry{name: name, info: info}
+		if !info.IsDir() {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+
+			entry.data, err = ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func readTar(path string, decompress func(io.Reader) (io.ReadCloser, error)) ([]archiveEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if decompress != nil {
+		rc, err := decompress(f)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		r = rc
+	}
+
+	var entries []archiveEntry
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		name, err := archiveName(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := archiveEntry{name: name, info: hdr.FileInfo()}
+		if hdr.Typeflag == tar.TypeReg {
+			if entry.data, err = ioutil.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("%s: %v", hdr.Name, err)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// archiveName returns the cleaned name of an archive entry,
+// names pointing outside of the archive are an error.
+func archiveName(name string) (string, error) {
+	cleaned, ok := binclude.CleanPath(name)
+	if !ok || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "\\") || strings.Contains(name, ":") {
+		return "", errors.New("archive entry points outside of the archive: " + name)
+	}
+
+	return cleaned, nil
+}
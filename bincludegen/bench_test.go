@@ -1,6 +1,12 @@
 package bincludegen_test
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/lu4p/binclude"
@@ -8,8 +14,46 @@ import (
 )
 
 func BenchmarkGenerate(b *testing.B) {
-	err := bincludegen.Generate(binclude.None, "./testdata/bench")
-	if err != nil {
+	if _, err := os.Stat("./testdata/bench/includedPrg/includedPrg"); err != nil {
+		b.Skip("run go generate in testdata/bench first:", err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		_, err := bincludegen.Generate(context.Background(), bincludegen.Options{Dir: "./testdata/bench"})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateJobs(b *testing.B) {
+	dir := b.TempDir()
+
+	main := "package main\n\nimport \"github.com/lu4p/binclude\"\n\nfunc main() {\n\tbinclude.Include(\"./assets\")\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0o644); err != nil {
 		b.Fatal(err)
 	}
+
+	content := bytes.Repeat([]byte("binclude benchmark content\n"), 2000)
+	for i := 0; i < 500; i++ {
+		sub := filepath.Join(dir, "assets", strconv.Itoa(i%10))
+		if err := os.MkdirAll(sub, 0o755); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(sub, strconv.Itoa(i)+".txt"), content, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, jobs := range []int{1, 2, 4, 8} {
+		b.Run("j="+strconv.Itoa(jobs), func(b *testing.B) {
+			opts := bincludegen.Options{Dir: dir, Compression: compression(binclude.Gzip), Jobs: jobs}
+			for i := 0; i < b.N; i++ {
+				if _, err := bincludegen.Generate(context.Background(), opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
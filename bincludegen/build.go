@@ -0,0 +1,472 @@
+package bincludegen
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lu4p/binclude"
+)
+
+// build builds a FileSystem per build tag from the included files.
+type build struct {
+	ctx        context.Context
+	dir        string
+	cfg        *Config
+	transforms []Transform
+	// prev files which didn't change since the generation described
+	// by prev keep their previous encoding
+	prev *previous
+	// stream the content of files without transforms isn't read,
+	// they are compressed with compress while the code is written
+	stream   bool
+	compress binclude.Compression
+	// jobs the number of files processed in parallel
+	jobs int
+
+	fileSystems map[string]*binclude.FileSystem
+	assets      []Asset
+	// streamed the paths on disk of streamed files by platform and path
+	streamed map[string]string
+	// changed whether anything differs from prev
+	changed bool
+	// sourceChanged whether the size or mtime of a file on disk differs
+	// from prev, only the manifest has to be written then
+	sourceChanged bool
+}
+
+// entry a file or directory found while walking the included files.
+type entry struct {
+	path string
+	// data the content of a file in an archive, path is empty then
+	data     []byte
+	info     os.FileInfo
+	buildTag string
+	asset    Asset
+	// pos the position of the binclude call which included the entry
+	pos token.Position
+
+	// set by process
+	content     []byte
+	compression binclude.Compression
+	streamed    bool
+	changed     bool
+	err         error
+}
+
+// walk walks the included files, the files are read, transformed and
+// compressed by b.jobs workers, the result doesn't depend on the order
+// they finish in.
+func (b *build) walk(includedFiles []includedFile) error {
+	b.fileSystems = make(map[string]*binclude.FileSystem)
+	b.streamed = make(map[string]string)
+	b.changed = b.prev == nil
+
+	b.fileSystems["default"] = &binclude.FileSystem{}
+	b.fileSystems["default"].Files = make(binclude.Files)
+
+	entries, err := b.collect(includedFiles)
+	if err != nil {
+		return err
+	}
+
+	b.process(entries)
+
+	return b.assemble(entries)
+}
+
+// collect walks the included files and returns every file and directory
+// which isn't excluded in walk order.
+func (b *build) collect(includedFiles []includedFile) ([]*entry, error) {
+	var (
+		entries            []*entry
+		current            includedFile
+		buildTag, platform string
+	)
+
+	var walkFn filepath.WalkFunc = func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+
+		source, err := sourcePath(b.dir, path)
+		if err != nil {
+			return err
+		}
+		source = filepath.ToSlash(source)
+		if current.source != "" {
+			source = current.source
+		}
+
+		rel, err := filepath.Rel(current.root, path)
+		if err != nil {
+			return err
+		}
+
+		target, err := targetPath(current, rel)
+		if err != nil {
+			return err
+		}
+
+		if target == "." {
+			return nil // the root directory is synthesized by binclude.FileSystem
+		}
+
+		excluded, err := b.cfg.excluded(target)
+		if err != nil {
+			return err
+		}
+
+		if excluded && info.IsDir() {
+			return filepath.SkipDir
+		}
+
+		if excluded {
+			return nil
+		}
+
+		entries = append(entries, &entry{
+			path:     path,
+			info:     info,
+			buildTag: buildTag,
+			asset:    b.newAsset(target, source, platform, info),
+			pos:      current.pos,
+		})
+
+		return nil
+	}
+
+	// addArchive adds the files in the archive current, the paths
+	// in the archive are joined with current.target.
+	addArchive := func(path string) error {
+		archived, err := readArchive(path)
+		if err != nil {
+			return err
+		}
+
+		source, err := sourcePath(b.dir, path)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range archived {
+			target := pathpkg.Join(current.target, a.name)
+			if target == "." {
+				continue
+			}
+
+			excluded, err := b.cfg.excluded(target)
+			if err != nil {
+				return err
+			}
+
+			if excluded {
+				continue
+			}
+
+			entries = append(entries, &entry{
+				data:     a.data,
+				info:     a.info,
+				buildTag: buildTag,
+				asset:    b.newAsset(target, filepath.ToSlash(source)+"!"+a.name, platform, a.info),
+				pos:      current.pos,
+			})
+		}
+
+		return nil
+	}
+
+	for _, file := range includedFiles {
+		current = file
+		buildTag = ""
+
+		for _, arch := range archs {
+			if strings.HasSuffix(file.goFile, arch+".go") {
+				buildTag = "_" + arch
+			}
+		}
+
+		for _, sys := range operatingSystems {
+			if strings.HasSuffix(file.goFile, sys+buildTag+".go") {
+				buildTag = "_" + sys + buildTag
+			}
+		}
+
+		platform = strings.TrimPrefix(buildTag, "_")
+		if len(buildTag) == 0 {
+			buildTag = "default"
+		}
+
+		var err error
+		if file.archive {
+			err = addArchive(filepath.Join(file.root, file.includedPath))
+		} else {
+			err = filepath.Walk(filepath.Join(file.root, file.includedPath), walkFn)
+		}
+
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return nil, err
+		}
+
+		if err != nil {
+			return nil, &Error{Pos: file.pos, Err: err}
+		}
+	}
+
+	return entries, nil
+}
+
+// newAsset returns the Asset of the file at target with the FileInfo of the file on disk.
+func (b *build) newAsset(target, source, platform string, info os.FileInfo) Asset {
+	asset := Asset{
+		Path:          target,
+		Source:        source,
+		Platform:      platform,
+		Mode:          info.Mode(),
+		ModTime:       info.ModTime(),
+		SourceSize:    info.Size(),
+		SourceModTime: info.ModTime(),
+	}
+
+	if b.cfg.Reproducible {
+		asset.ModTime = time.Unix(0, 0)
+	}
+
+	return asset
+}
+
+// process processes the entries with a bounded number of workers. The entries
+// are handed out in order and no new entry is started after an error,
+// so every entry before the first failed one is processed.
+func (b *build) process(entries []*entry) {
+	jobs := b.jobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		next   int64 = -1
+		failed int32
+		wg     sync.WaitGroup
+	)
+
+	for w := 0; w < jobs && w < len(entries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for atomic.LoadInt32(&failed) == 0 {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(entries) {
+					return
+				}
+
+				e := entries[i]
+				if e.err = b.ctx.Err(); e.err == nil {
+					e.err = b.processEntry(e)
+				}
+
+				if e.err != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// processEntry hashes, reads, transforms and compresses the file of e,
+// unless its previous encoding can be reused or it is streamed.
+func (b *build) processEntry(e *entry) error {
+	if e.info.IsDir() {
+		return nil
+	}
+
+	asset := &e.asset
+	target, source := asset.Path, asset.Source
+
+	old, ok := b.prev.asset(asset.Platform, target)
+
+	var (
+		raw []byte
+		err error
+	)
+
+	if e.path == "" {
+		raw = e.data
+		asset.SHA256 = sha256Hex(raw)
+	} else if ok && old.unmodified(source, e.info) {
+		asset.SHA256 = old.SHA256
+	} else if b.stream {
+		if asset.SHA256, err = hashFile(e.path); err != nil {
+			return err
+		}
+	} else {
+		if raw, err = ioutil.ReadFile(e.path); err != nil {
+			return err
+		}
+		asset.SHA256 = sha256Hex(raw)
+	}
+
+	if ok && old.SHA256 != asset.SHA256 {
+		e.changed = true
+	}
+
+	transformed, err := matchesAny(b.transforms, target)
+	if err != nil {
+		return err
+	}
+
+	if ok && old.SHA256 == asset.SHA256 && old.Source == source {
+		if b.stream {
+			asset.Size, asset.EncodedSize = old.Size, old.EncodedSize
+		} else if file, found := b.prev.file(e.buildTag, target); found {
+			e.content, e.compression = file.Content, file.Compression
+			asset.Size, asset.EncodedSize = old.Size, int64(len(file.Content))
+			return nil
+		}
+	}
+
+	if b.stream && !transformed && e.path != "" {
+		// encoded while the code is written
+		asset.Size = e.info.Size()
+		if binclude.ShouldCompress(target) {
+			e.compression = b.compress
+		}
+		e.streamed = true
+		return nil
+	}
+
+	if !b.stream {
+		e.changed = true
+	}
+
+	if raw == nil {
+		if raw, err = ioutil.ReadFile(e.path); err != nil {
+			return err
+		}
+	}
+
+	content, err := transform(b.transforms, target, raw)
+	if err != nil {
+		return err
+	}
+	asset.Size = int64(len(content))
+
+	file := &binclude.File{Filename: pathpkg.Base(target), Mode: e.info.Mode(), Content: content}
+	fs := &binclude.FileSystem{Files: binclude.Files{target: file}}
+	if err := fs.Compress(b.compress); err != nil {
+		return err
+	}
+
+	e.content, e.compression = file.Content, file.Compression
+	asset.EncodedSize = int64(len(file.Content))
+	return nil
+}
+
+// assemble adds the processed entries to the FileSystems in walk order,
+// the first error in walk order is returned.
+func (b *build) assemble(entries []*entry) error {
+	totalSizes := make(map[string]Size)
+	assetIndex := make(map[string]int)
+
+	for _, e := range entries {
+		if e.err != nil {
+			if e.err == context.Canceled || e.err == context.DeadlineExceeded {
+				return e.err
+			}
+
+			return &Error{Pos: e.pos, Err: e.err}
+		}
+
+		asset, buildTag := e.asset, e.buildTag
+		target := asset.Path
+
+		old, ok := b.prev.asset(asset.Platform, target)
+		if !ok || old.Source != asset.Source || old.Mode != asset.Mode || !old.ModTime.Equal(asset.ModTime) || e.changed {
+			b.changed = true
+		} else if old.SourceSize != asset.SourceSize || !old.SourceModTime.Equal(asset.SourceModTime) {
+			b.sourceChanged = true
+		}
+
+		key := asset.Platform + "\x00" + target
+		delete(b.streamed, key)
+		if e.streamed {
+			b.streamed[key] = e.path
+		}
+
+		if i, ok := assetIndex[key]; ok {
+			// included more than once, the last one wins
+			totalSizes[buildTag] -= Size(b.assets[i].Size)
+			b.assets[i] = asset
+		} else {
+			assetIndex[key] = len(b.assets)
+			b.assets = append(b.assets, asset)
+		}
+
+		if !e.info.IsDir() {
+			size := Size(asset.Size)
+			if b.cfg.MaxFileSize > 0 && size > b.cfg.MaxFileSize {
+				return &Error{Pos: e.pos, Err: fmt.Errorf("%s is larger than the max file size: %d > %d bytes", target, size, b.cfg.MaxFileSize)}
+			}
+
+			totalSizes[buildTag] += size
+			if b.cfg.MaxTotalSize > 0 && totalSizes[buildTag] > b.cfg.MaxTotalSize {
+				return &Error{Pos: e.pos, Err: fmt.Errorf("included files are larger than the max total size: %d > %d bytes", totalSizes[buildTag], b.cfg.MaxTotalSize)}
+			}
+		}
+
+		if b.fileSystems[buildTag] == nil {
+			b.fileSystems[buildTag] = &binclude.FileSystem{}
+			b.fileSystems[buildTag].Files = make(binclude.Files)
+		}
+		createFile(b.fileSystems[buildTag], target, &binclude.File{
+			Filename:    pathpkg.Base(target),
+			Mode:        e.info.Mode(),
+			ModTime:     asset.ModTime,
+			Content:     e.content,
+			Compression: e.compression,
+		})
+	}
+
+	if b.prev != nil && len(b.prev.assets) != len(b.assets) {
+		b.changed = true
+	}
+
+	sort.SliceStable(b.assets, func(i, j int) bool {
+		if b.assets[i].Platform != b.assets[j].Platform {
+			return b.assets[i].Platform < b.assets[j].Platform
+		}
+		return b.assets[i].Path < b.assets[j].Path
+	})
+
+	return nil
+}
+
+// sourcePath returns path relative to dir, path is absolute
+// if it is in the module root or a module dependency.
+func sourcePath(dir, path string) (string, error) {
+	if filepath.IsAbs(path) && !filepath.IsAbs(dir) {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Rel(dir, path)
+}
@@ -0,0 +1,370 @@
+package bincludegen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lu4p/binclude"
+)
+
+// ChangeKind the kind of a Change.
+type ChangeKind int
+
+const (
+	// Added the asset or generated file is missing on disk.
+	Added ChangeKind = iota
+	// Removed the asset or generated file on disk isn't generated anymore.
+	Removed
+	// Changed the content, compression or type of the asset differs.
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "+"
+	case Removed:
+		return "-"
+	}
+
+	return "~"
+}
+
+// Change a difference between the generated files on disk and the regenerated ones.
+type Change struct {
+	Kind ChangeKind
+	// File the name of the generated file, e.g. binclude.go.
+	File string
+	// Path the path of the asset in the FileSystem, empty if the whole generated
+	// file was added or removed or the code around the assets changed,
+	// like the package clause, the included modules or the variable name.
+	Path string
+}
+
+func (c Change) String() string {
+	if c.Path == "" {
+		return c.Kind.String() + " " + c.File
+	}
+
+	return c.File + ": " + c.Kind.String() + " " + c.Path
+}
+
+// Check regenerates the package in opts.Dir in memory and compares the result
+// with the generated files on disk, it returns no Changes if they are up to date.
+// The code around the assets has to match exactly.
+// The ModTime and permission bits other than the executable bits are ignored,
+// because they depend on the checkout. Options.Incremental and Options.Stream
+// are ignored, the files on disk would be compared with themselves otherwise.
+func Check(ctx context.Context, opts Options) ([]Change, error) {
+	opts.Incremental = false
+	opts.Stream = false
+
+	res, err := Generate(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+
+	cfg := opts.Config
+	if cfg == nil {
+		if cfg, err = LoadConfig(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	onDisk, err := generatedFiles(dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, file := range res.Files {
+		if !onDisk[file.Name] {
+			changes = append(changes, Change{Kind: Added, File: file.Name})
+			continue
+		}
+		delete(onDisk, file.Name)
+
+		oldCode, err := codeSkeleton(file.Path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		code, err := codeSkeleton(file.Path, file.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(oldCode, code) {
+			changes = append(changes, Change{Kind: Changed, File: file.Name})
+		}
+
+		old, err := parseDecompressed(file.Path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		regenerated, err := parseDecompressed(file.Path, file.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, diffAssets(file.Name, old, regenerated)...)
+	}
+
+	var removed []string
+	for name := range onDisk {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+
+	for _, name := range removed {
+		changes = append(changes, Change{Kind: Removed, File: name})
+	}
+
+	return changes, nil
+}
+
+// generatedFiles returns the names of the files in dir generated with cfg.
+func generatedFiles(dir string, cfg *Config) (map[string]bool, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() && strings.HasSuffix(name, ".go") && !strings.Contains(name, "_test") && cfg.isOutput(name) {
+			names[name] = true
+		}
+	}
+
+	return names, nil
+}
+
+func diffAssets(name string, old, regenerated binclude.Files) []Change {
+	var paths []string
+	for path := range old {
+		paths = append(paths, path)
+	}
+	for path := range regenerated {
+		if _, ok := old[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var changes []Change
+	for _, path := range paths {
+		o, r := old[path], regenerated[path]
+		switch {
+		case o == nil:
+			changes = append(changes, Change{Kind: Added, File: name, Path: path})
+		case r == nil:
+			changes = append(changes, Change{Kind: Removed, File: name, Path: path})
+		case o.Mode.IsDir() != r.Mode.IsDir() ||
+			o.Mode&0o111 != r.Mode&0o111 ||
+			o.Compression != r.Compression ||
+			!bytes.Equal(o.Content, r.Content):
+			changes = append(changes, Change{Kind: Changed, File: name, Path: path})
+		}
+	}
+
+	return changes
+}
+
+// parseDecompressed like parseGeneratedFile but decompresses the content.
+func parseDecompressed(path string, src []byte) (binclude.Files, error) {
+	files, err := parseGeneratedFile(path, src)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &binclude.FileSystem{Files: files}
+	if err := fs.Decompress(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return files, nil
+}
+
+// parseGeneratedFile parses the Files of the FileSystem declared in a generated file,
+// if src is nil the file at path is read.
+// Only Filename, Mode, Compression and Content are set.
+func parseGeneratedFile(path string, src []byte) (binclude.Files, error) {
+	if src == nil {
+		var err error
+		if src, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(binclude.Files)
+
+	var parseErr error
+	ast.Inspect(f, func(node ast.Node) bool {
+		lit, ok := node.(*ast.CompositeLit)
+		if !ok || parseErr != nil || !isFilesType(lit.Type) {
+			return parseErr == nil
+		}
+
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+
+			key, err := unquote(kv.Key)
+			if err != nil {
+				parseErr = fmt.Errorf("%s: %v", fset.Position(kv.Pos()), err)
+				return false
+			}
+
+			file, err := parseFileLit(kv.Value)
+			if err != nil {
+				parseErr = fmt.Errorf("%s: %v", fset.Position(kv.Pos()), err)
+				return false
+			}
+
+			files[key] = file
+		}
+
+		return false
+	})
+
+	return files, parseErr
+}
+
+// codeSkeleton returns the source of a generated file without the entries of
+// its binclude.Files literals, if src is nil the file at path is read.
+func codeSkeleton(path string, src []byte) ([]byte, error) {
+	if src == nil {
+		var err error
+		if src, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		skeleton []byte
+		last     int
+	)
+
+	ast.Inspect(f, func(node ast.Node) bool {
+		lit, ok := node.(*ast.CompositeLit)
+		if !ok || !isFilesType(lit.Type) {
+			return true
+		}
+
+		skeleton = append(skeleton, src[last:fset.Position(lit.Lbrace).Offset+1]...)
+		last = fset.Position(lit.Rbrace).Offset
+		return false
+	})
+
+	return append(skeleton, src[last:]...), nil
+}
+
+// isFilesType reports whether expr is binclude.Files.
+func isFilesType(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Files" {
+		return false
+	}
+
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == "binclude"
+}
+
+// parseFileLit parses a binclude.File composite literal as written by fileCode.
+func parseFileLit(expr ast.Expr) (*binclude.File, error) {
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil, fmt.Errorf("unexpected expression %T", expr)
+	}
+
+	var file binclude.File
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+
+		field, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch field.Name {
+		case "Filename":
+			file.Filename, err = unquote(kv.Value)
+		case "Mode":
+			var mode uint64
+			mode, err = parseUint(kv.Value)
+			file.Mode = os.FileMode(mode)
+		case "Compression":
+			var compression uint64
+			compression, err = parseUint(kv.Value)
+			file.Compression = binclude.Compression(compression)
+		case "Content":
+			call, ok := kv.Value.(*ast.CallExpr)
+			if !ok || len(call.Args) != 1 {
+				return nil, fmt.Errorf("unexpected Content %T", kv.Value)
+			}
+
+			var content string
+			content, err = unquote(call.Args[0])
+			file.Content = []byte(content)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field.Name, err)
+		}
+	}
+
+	return &file, nil
+}
+
+func unquote(expr ast.Expr) (string, error) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", fmt.Errorf("expected string literal got %T", expr)
+	}
+
+	return strconv.Unquote(lit.Value)
+}
+
+func parseUint(expr ast.Expr) (uint64, error) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return 0, fmt.Errorf("expected integer literal got %T", expr)
+	}
+
+	return strconv.ParseUint(lit.Value, 0, 64)
+}
@@ -0,0 +1,69 @@
+package bincludegen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runCommands runs the commands of binclude.IncludeCommand in dir in the order of the
+// calls, the output of every command is written to the cache and included from there.
+func runCommands(ctx context.Context, dir string, includedFiles []includedFile) error {
+	for i, file := range includedFiles {
+		if len(file.command) == 0 {
+			continue
+		}
+
+		path, err := runCommand(ctx, dir, file.command)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return err
+		}
+
+		if err != nil {
+			return &Error{Pos: file.pos, Err: err}
+		}
+
+		includedFiles[i].root, includedFiles[i].includedPath = filepath.Split(path)
+		includedFiles[i].source = "command: " + strings.Join(file.command, " ")
+	}
+
+	return nil
+}
+
+// runCommand runs the command line in dir and returns the path of its output in the cache.
+func runCommand(ctx context.Context, dir string, command []string) (string, error) {
+	cache, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("%s failed: %v", strings.Join(command, " "), err)
+		}
+
+		return "", fmt.Errorf("%s failed: %v: %s", strings.Join(command, " "), err, msg)
+	}
+
+	path, _, err := writeCache(cache, &stdout, "")
+	if err != nil {
+		return "", fmt.Errorf("cannot cache the output of %s: %v", command[0], err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,261 @@
+package bincludegen
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lu4p/binclude"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigNames the names of the config file which is read from the package directory.
+var ConfigNames = []string{"binclude.yaml", "binclude.yml"}
+
+// Config the generator settings of a package, usually read from a
+// binclude.yaml file next to the go files of the package.
+type Config struct {
+	// Compression the compression algorithm, either "none" or "gzip".
+	Compression string `yaml:"compression"`
+	// Minify minify css, js, json, svg and html files.
+	Minify bool `yaml:"minify"`
+	// Transforms applied in order, in the form pattern=name[,name...] see ParseTransform.
+	Transforms []string `yaml:"transforms"`
+	// Exclude files and directories matching one of the patterns aren't included,
+	// patterns without a slash are matched against the file name,
+	// all others against the path in the FileSystem, see binclude.Match.
+	Exclude []string `yaml:"exclude"`
+	// Output the name of the generated file, defaults to binclude.go.
+	// Files for specific platforms are named like output_linux.go.
+	Output string `yaml:"output"`
+	// Variable the name of the generated FileSystem variable, defaults to BinFS.
+	Variable string `yaml:"variable"`
+	// Reproducible sets the ModTime of all files to the unix epoch,
+	// so the generated code doesn't change if only the mtimes on disk change.
+	Reproducible bool `yaml:"reproducible"`
+	// MaxFileSize generation fails if a single file is larger, 0 means no limit.
+	MaxFileSize Size `yaml:"max_file_size"`
+	// MaxTotalSize generation fails if all files of a FileSystem together are larger, 0 means no limit.
+	MaxTotalSize Size `yaml:"max_total_size"`
+}
+
+// LoadConfig reads the config file from dir,
+// if no config file exists an empty Config is returned.
+func LoadConfig(dir string) (*Config, error) {
+	for _, name := range ConfigNames {
+		path := filepath.Join(dir, name)
+
+		cfg, err := ReadConfig(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		return cfg, err
+	}
+
+	return &Config{}, nil
+}
+
+// ReadConfig reads the config file at path.
+func ReadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if _, err := cfg.compression(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if _, err := cfg.transforms(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// compression returns the configured compression algorithm.
+func (cfg *Config) compression() (binclude.Compression, error) {
+	switch cfg.Compression {
+	case "", "none":
+		return binclude.None, nil
+	case "gzip":
+		return binclude.Gzip, nil
+	}
+
+	return binclude.None, errors.New("unknown compression: " + cfg.Compression)
+}
+
+// transforms returns the configured transforms, the minifiers come first.
+func (cfg *Config) transforms() ([]Transform, error) {
+	var transforms []Transform
+	if cfg.Minify {
+		transforms = Minify()
+	}
+
+	for _, s := range cfg.Transforms {
+		t, err := ParseTransform(s)
+		if err != nil {
+			return nil, err
+		}
+
+		transforms = append(transforms, t...)
+	}
+
+	return transforms, nil
+}
+
+// output returns the name of the generated file for buildTag.
+func (cfg *Config) output(buildTag string) string {
+	output := cfg.Output
+	if output == "" {
+		output = "binclude.go"
+	}
+
+	if buildTag == "default" {
+		return output
+	}
+
+	return strings.TrimSuffix(output, ".go") + buildTag + ".go"
+}
+
+// isOutput reports whether the file name was generated with this Config.
+// Other files like binclude_helper.go are no output.
+func (cfg *Config) isOutput(name string) bool {
+	prefix := strings.TrimSuffix(cfg.output("default"), ".go")
+	if name == prefix+".go" {
+		return true
+	}
+
+	if !strings.HasPrefix(name, prefix+"_") || !strings.HasSuffix(name, ".go") {
+		return false
+	}
+
+	// only platform specific files like output_linux_amd64.go
+	for _, elem := range strings.Split(name[len(prefix)+1:len(name)-3], "_") {
+		if !contains(operatingSystems, elem) && !contains(archs, elem) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// variable returns the name of the generated FileSystem variable.
+func (cfg *Config) variable() string {
+	if cfg.Variable == "" {
+		return "BinFS"
+	}
+
+	return cfg.Variable
+}
+
+// excluded reports whether the file at path in the FileSystem is excluded.
+func (cfg *Config) excluded(path string) (bool, error) {
+	for _, pattern := range cfg.Exclude {
+		name := path
+		if !strings.Contains(pattern, "/") {
+			name = path[strings.LastIndex(path, "/")+1:]
+		}
+
+		ok, err := binclude.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("exclude %s: %v", pattern, err)
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Size a size in bytes, which can be written with a unit like 10MB or 1GiB.
+type Size int64
+
+var sizeUnits = []struct {
+	suffix string
+	size   Size
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"kB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a size like 1024, 10MB or 1GiB.
+func ParseSize(s string) (Size, error) {
+	value := strings.TrimSpace(s)
+
+	unit := Size(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size: " + s)
+	}
+
+	return Size(n) * unit, nil
+}
+
+func (s Size) String() string {
+	return strconv.FormatInt(int64(s), 10)
+}
+
+// Set implements flag.Value.
+func (s *Size) Set(value string) error {
+	size, err := ParseSize(value)
+	if err != nil {
+		return err
+	}
+
+	*s = size
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Size) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	return s.Set(value)
+}
+
+// stringsFlag implements flag.Value for repeatable string flags.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
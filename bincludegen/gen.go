@@ -2,16 +2,21 @@
 package bincludegen
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"io/ioutil"
 	"log"
 	"os"
+	pathpkg "path"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
@@ -21,50 +26,290 @@ import (
 var (
 	operatingSystems = []string{"linux", "windows", "darwin", "freebsd", "js", "plan9", "freebsd", "dragonfly", "openbsd", "solaris", "aix", "android"}
 	archs            = []string{"ppc64", "386", "amd64", "wasm", "arm", "ppc64le", "mips", "mips64", "mips64le", "mipsle", "s390x", "arm64"}
-
-	gzip bool
 )
 
-func init() {
-	flag.BoolVar(&gzip, "gzip", false, "compress files with gzip")
+// flags the command line flags of binclude, they are kept out of
+// flag.CommandLine so that bincludegen can be imported by other tools.
+type flags struct {
+	configPath   string
+	check        bool
+	force        bool
+	stream       bool
+	jobs         int
+	report       bool
+	reportJSON   string
+	reportTop    int
+	gzip         bool
+	minify       bool
+	transforms   transformFlag
+	excludes     stringsFlag
+	output       string
+	variable     string
+	reproducible bool
+	maxFileSize  Size
+	maxTotalSize Size
+
+	set *flag.FlagSet
+}
+
+// parseFlags parses the command line arguments args.
+func parseFlags(args []string) (*flags, error) {
+	f := &flags{set: flag.NewFlagSet("binclude", flag.ContinueOnError)}
+
+	set := f.set
+	set.StringVar(&f.configPath, "config", "", "read the config from `file` instead of binclude.yaml")
+	set.BoolVar(&f.check, "check", false, "don't write files, fail if the generated files are not up to date")
+	set.BoolVar(&f.force, "force", false, "regenerate all files even if they didn't change")
+	set.BoolVar(&f.stream, "stream", false, "stream large files from disk instead of reading them into memory")
+	set.IntVar(&f.jobs, "j", 0, "number of files processed in parallel (default GOMAXPROCS)")
+	set.BoolVar(&f.report, "report", false, "print a size report of the included files")
+	set.StringVar(&f.reportJSON, "report-json", "", "write the size report as JSON to `file`, - for stdout")
+	set.IntVar(&f.reportTop, "top", 10, "number of the largest files and directories in the size report")
+	set.BoolVar(&f.gzip, "gzip", false, "compress files with gzip")
+	set.BoolVar(&f.minify, "minify", false, "minify css, js, json, svg and html files")
+	set.Var(&f.transforms, "transform", "apply transformers to matching files `pattern=name[,name...]`, can be repeated")
+	set.Var(&f.excludes, "exclude", "exclude files matching `pattern`, can be repeated")
+	set.StringVar(&f.output, "o", "", "name of the generated `file` (default binclude.go)")
+	set.StringVar(&f.variable, "var", "", "`name` of the generated FileSystem variable (default BinFS)")
+	set.BoolVar(&f.reproducible, "reproducible", false, "set the ModTime of all files to the unix epoch")
+	set.Var(&f.maxFileSize, "max-file-size", "fail if a file is larger than `size`, e.g. 10MB")
+	set.Var(&f.maxTotalSize, "max-total-size", "fail if all files together are larger than `size`, e.g. 100MB")
+
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return f, nil
 }
 
 // Main1 gets called by cmd/binclude for code generation
 func Main1() int {
-	flag.Parse()
-	compress := binclude.None
-	if gzip {
-		compress = binclude.Gzip
+	f, err := parseFlags(os.Args[1:])
+	if err == flag.ErrHelp {
+		return 0
+	}
+
+	if err != nil {
+		return 2
 	}
 
 	log.SetPrefix("[binclude] ")
 
-	err := Generate(compress, ".")
+	cfg, err := f.loadConfig(".")
+	if err != nil {
+		log.Println("failed:", err)
+		return 1
+	}
+
+	if f.check {
+		return checkMain(cfg)
+	}
+
+	if f.set.Arg(0) == "append" {
+		return appendMain(cfg, f.jobs, f.set.Args()[1:])
+	}
+
+	opts := Options{Dir: ".", Config: cfg, Incremental: !f.force, Top: f.reportTop, Stream: f.stream, Jobs: f.jobs}
+
+	res, err := Generate(context.Background(), opts)
 	if err != nil {
 		log.Println("failed:", err)
 		return 1
 	}
 
+	if err := res.Write(); err != nil {
+		log.Println("failed:", err)
+		return 1
+	}
+
+	if res.Unchanged {
+		log.Println("generated files are up to date")
+	}
+
+	if err := f.writeReport(res.Report); err != nil {
+		log.Println("failed:", err)
+		return 1
+	}
+
 	return 0
 }
 
-// Generate a binclude.go file for the current working directory
-func Generate(compress binclude.Compression, dir string) error {
+// writeReport implements the -report and -report-json flags.
+func (f *flags) writeReport(r *Report) error {
+	if f.report {
+		if err := r.WriteText(os.Stderr, f.reportTop); err != nil {
+			return err
+		}
+	}
+
+	if f.reportJSON == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if f.reportJSON == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(f.reportJSON, data, 0o666)
+}
+
+// checkMain implements the -check flag.
+func checkMain(cfg *Config) int {
+	changes, err := Check(context.Background(), Options{Dir: ".", Config: cfg})
+	if err != nil {
+		log.Println("failed:", err)
+		return 1
+	}
+
+	if len(changes) == 0 {
+		return 0
+	}
+
+	log.Println("generated files are not up to date, run go generate:")
+	for _, change := range changes {
+		fmt.Fprintln(os.Stderr, change)
+	}
+
+	return 1
+}
+
+// loadConfig reads the config file of dir or the one given with -config
+// and overrides its settings with the flags set on the command line,
+// repeatable flags are appended to the lists of the config file.
+func (f *flags) loadConfig(dir string) (*Config, error) {
+	var (
+		cfg *Config
+		err error
+	)
+
+	if f.configPath != "" {
+		cfg, err = ReadConfig(f.configPath)
+	} else {
+		cfg, err = LoadConfig(dir)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "gzip":
+			cfg.Compression = "none"
+			if f.gzip {
+				cfg.Compression = "gzip"
+			}
+		case "minify":
+			cfg.Minify = f.minify
+		case "transform":
+			cfg.Transforms = append(cfg.Transforms, f.transforms...)
+		case "exclude":
+			cfg.Exclude = append(cfg.Exclude, f.excludes...)
+		case "o":
+			cfg.Output = f.output
+		case "var":
+			cfg.Variable = f.variable
+		case "reproducible":
+			cfg.Reproducible = f.reproducible
+		case "max-file-size":
+			cfg.MaxFileSize = f.maxFileSize
+		case "max-total-size":
+			cfg.MaxTotalSize = f.maxTotalSize
+		}
+	})
+
+	return cfg, nil
+}
+
+// Options configures Generate.
+type Options struct {
+	// Dir the directory of the package, all include paths are relative to it.
+	// Defaults to the current working directory.
+	Dir string
+	// Config the generator settings, if nil the config file in Dir is read.
+	Config *Config
+	// Compression overrides the configured compression if it isn't nil,
+	// binclude.None turns compression off.
+	Compression *binclude.Compression
+	// Transforms are applied after the configured ones.
+	Transforms []Transform
+	// Incremental reuses the encoded content of files which didn't change
+	// since the last generation, according to the manifest in Dir.
+	// If nothing changed the Result is Unchanged.
+	Incremental bool
+	// Top the number of largest files listed per FileSystem in the Report, defaults to 10.
+	Top int
+	// Stream doesn't keep the content of the included files in memory,
+	// files without transforms are read, compressed and written to the
+	// generated code piece by piece when the Result is written.
+	Stream bool
+	// Jobs the number of files which are read, transformed and compressed
+	// in parallel, defaults to GOMAXPROCS.
+	Jobs int
+}
+
+// Generate generates the binclude.go files for the package in opts.Dir,
+// the files are returned and not written to disk.
+// Errors caused by a binclude call are of type *Error.
+func Generate(ctx context.Context, opts Options) (*Result, error) {
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+
+	cfg := opts.Config
+	if cfg == nil {
+		var err error
+		if cfg, err = LoadConfig(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	compress, err := cfg.compression()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Compression != nil {
+		compress = *opts.Compression
+	}
+
+	transforms, err := cfg.transforms()
+	if err != nil {
+		return nil, err
+	}
+	transforms = append(transforms, opts.Transforms...)
+
+	if !token.IsIdentifier(cfg.variable()) {
+		return nil, errors.New("invalid variable name: " + cfg.variable())
+	}
+
 	fset := token.NewFileSet()
 	filter := func(info os.FileInfo) bool {
 		if strings.Contains(info.Name(), "_test") {
 			return false
 		}
-		return !strings.HasPrefix(info.Name(), "binclude")
+		return !cfg.isOutput(info.Name())
 	}
 
 	pkgs, err := parser.ParseDir(fset, dir, filter, parser.ParseComments)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if len(pkgs) == 0 {
+		return nil, errors.New("no go files in " + dir)
 	}
 
 	if len(pkgs) > 1 {
-		return errors.New("more than one package in the current directory")
+		return nil, errors.New("more than one package in " + dir)
 	}
 
 	var (
@@ -76,176 +321,368 @@ func Generate(compress binclude.Compression, dir string) error {
 		break // only get the first package
 	}
 
-	includedFiles, err := detectIncluded(pkg)
+	includedFiles, err := detectIncluded(fset, pkg, dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fileSystems, err := buildFS(includedFiles)
-	if err != nil {
-		return err
+	if err := runCommands(ctx, dir, includedFiles); err != nil {
+		return nil, err
 	}
 
-	for _, fs := range fileSystems {
-		if err := fs.Compress(compress); err != nil {
-			return err
-		}
+	lock, err := readLock(dir)
+	if err != nil {
+		return nil, err
 	}
 
-	return generateFiles(dir, pkgName, fileSystems)
-}
+	if lock, err = fetchIncluded(ctx, dir, includedFiles, lock); err != nil {
+		return nil, err
+	}
 
-func buildFS(includedFiles []includedFile) (map[string]*binclude.FileSystem, error) {
-	const bincludeName = "binclude"
-	fileSystems := make(map[string]*binclude.FileSystem)
-	var buildTag string
+	if includedFiles, err = resolveIncluded(dir, includedFiles); err != nil {
+		return nil, err
+	}
 
-	fileSystems["default"] = &binclude.FileSystem{}
-	fileSystems["default"].Files = make(binclude.Files)
+	modules := includedModules(includedFiles)
+	options := optionsKey(cfg, compress, transforms, modules)
 
-	var walkFn filepath.WalkFunc = func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	var prev *previous
+	if opts.Incremental {
+		prev = loadPrevious(dir, cfg, pkgName, options)
+	}
 
-		var content []byte
+	b := &build{
+		ctx:        ctx,
+		dir:        dir,
+		cfg:        cfg,
+		transforms: transforms,
+		prev:       prev,
+		stream:     opts.Stream,
+		compress:   compress,
+		jobs:       opts.Jobs,
+	}
 
-		if !info.IsDir() {
-			content, err = ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
+	if err := b.walk(includedFiles); err != nil {
+		return nil, err
+	}
 
-		}
+	res := &Result{
+		Manifest:     Manifest{Package: pkgName, Options: options, Assets: b.assets},
+		ManifestPath: filepath.Join(dir, cfg.manifestName()),
+		LockPath:     filepath.Join(dir, LockName),
+		lock:         lock.bytes(),
+		top:          top(opts),
+		fileSystems:  b.fileSystems,
+	}
+	assets := res.Manifest.Assets
 
-		path = filepath.ToSlash(path)
+	var buildTags []string
+	for buildTag := range b.fileSystems {
+		buildTags = append(buildTags, buildTag)
+	}
 
-		if fileSystems[buildTag] == nil {
-			fileSystems[buildTag] = &binclude.FileSystem{}
-			fileSystems[buildTag].Files = make(binclude.Files)
+	if !b.changed {
+		// regenerate if a generated file was deleted
+		if res.Files, err = readGenerated(dir, cfg, buildTags, opts.Stream); err == nil {
+			res.Unchanged = true
+			res.sourceChanged = b.sourceChanged
+			res.Report = newReport(assets, res.top)
+			return res, nil
 		}
-		createFile(fileSystems[buildTag], path, &binclude.File{
-			Filename: info.Name(),
-			Mode:     info.Mode(),
-			ModTime:  info.ModTime(),
-			Content:  content,
-		})
-
-		return nil
 	}
 
-	for _, file := range includedFiles {
-		buildTag = ""
-
-		for _, arch := range archs {
-			if strings.HasSuffix(file.goFile, arch+".go") {
-				buildTag = "_" + arch
-			}
+	var sources map[string]map[string]streamSource
+	if opts.Stream {
+		sources = make(map[string]map[string]streamSource)
+		for _, buildTag := range buildTags {
+			sources[buildTag] = make(map[string]streamSource)
 		}
 
-		for _, sys := range operatingSystems {
-			if strings.HasSuffix(file.goFile, sys+buildTag+".go") {
-				buildTag = "_" + sys + buildTag
+		for i, asset := range assets {
+			if path, ok := b.streamed[asset.Platform+"\x00"+asset.Path]; ok {
+				sources[asset.buildTag()][asset.Path] = streamSource{path: path, encodedSize: &assets[i].EncodedSize}
 			}
 		}
+	} else {
+		res.Report = newReport(assets, res.top)
+	}
 
-		if len(buildTag) == 0 {
-			buildTag = "default"
-		}
+	res.Files, err = generateFiles(dir, pkgName, b.fileSystems, cfg, modules, sources)
+	if err != nil {
+		return nil, err
+	}
 
-		err := filepath.Walk(file.includedPath, walkFn)
-		if err != nil {
-			return nil, err
-		}
+	return res, nil
+}
+
+func top(opts Options) int {
+	if opts.Top <= 0 {
+		return 10
 	}
 
-	return fileSystems, nil
+	return opts.Top
 }
 
 type includedFile struct {
 	includedPath, goFile string
+	// root the directory includedPath is relative to,
+	// the package directory, the module root or a module dependency
+	root string
+	// module the module dependency the file is included from
+	module *module
+	// url and sha256 of a file included via IncludeURL,
+	// it is fetched into the cache before the files are walked
+	url, sha256 string
+	// command the command line of IncludeCommand, its output
+	// is written to the cache before the files are walked
+	command []string
+	// archive whether includedPath is an archive, its files
+	// are included under target
+	archive bool
+	// source replaces the path on disk in the manifest for
+	// fetched files and command outputs
+	source string
+	// target the path in the FileSystem, if empty includedPath is used
+	target string
+	// expand the binclude function, IncludeGlob or IncludeFromFile, whose
+	// includedPath is expanded after the commands have run
+	expand string
+	// pos the position of the binclude call
+	pos token.Position
 }
 
-func detectIncluded(pkg *ast.Package) ([]includedFile, error) {
-	var includedFiles []includedFile
+// targetPath returns the path in the FileSystem for the file at source,
+// which was found while walking file.includedPath.
+func targetPath(file includedFile, source string) (string, error) {
+	if file.target == "" {
+		return filepath.ToSlash(source), nil
+	}
+
+	rel, err := filepath.Rel(file.includedPath, source)
+	if err != nil {
+		return "", err
+	}
+
+	target, ok := binclude.CleanPath(pathpkg.Join(file.target, filepath.ToSlash(rel)))
+	if !ok {
+		return "", errors.New("target points outside of the FileSystem: " + file.target)
+	}
+
+	return target, nil
+}
 
-	var currentGoFile string
+func detectIncluded(fset *token.FileSet, pkg *ast.Package, dir string) ([]includedFile, error) {
+	var (
+		includedFiles []includedFile
+		currentGoFile string
+		firstErr      error
+	)
+
+	info := typeCheck(fset, pkg)
 
 	visit := func(node ast.Node) bool {
-		if node == nil {
-			return true
+		if node == nil || firstErr != nil {
+			return firstErr == nil
 		}
 
 		call, ok := node.(*ast.CallExpr)
 		if !ok {
 			return true
 		}
-		sel, ok := call.Fun.(*ast.SelectorExpr)
+
+		name, ok := bincludeFunc(info, call)
 		if !ok {
 			return true
 		}
 
-		v, ok := sel.X.(*ast.Ident)
-		if !ok {
-			return true
+		pos := fset.Position(call.Pos())
+		included, err := includeCall(info, call, name, dir, includedFile{goFile: currentGoFile, pos: pos})
+		if err != nil {
+			firstErr = &Error{Pos: pos, Err: err}
+			return false
 		}
 
-		if v.Name != "binclude" {
-			return true
+		includedFiles = append(includedFiles, included...)
+		return true
+	}
+
+	// iterate in a fixed order so that errors and the order of the
+	// included files don't depend on map iteration
+	var goFiles []string
+	for path := range pkg.Files {
+		goFiles = append(goFiles, path)
+	}
+	sort.Strings(goFiles)
+
+	for _, path := range goFiles {
+		currentGoFile = path
+		ast.Inspect(pkg.Files[path], visit)
+
+		if firstErr != nil {
+			return nil, firstErr
 		}
+	}
+
+	return includedFiles, nil
+}
 
-		lit, ok := call.Args[0].(*ast.BasicLit)
-		if !ok || lit.Kind != token.STRING {
-			log.Fatalln("argument is not string literal")
+// resolveIncluded expands globs and file lists, resolves the directories the included
+// paths are relative to and checks that they exist, it runs after the commands and downloads.
+func resolveIncluded(dir string, includedFiles []includedFile) ([]includedFile, error) {
+	includedFiles, err := expandIncluded(dir, includedFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, file := range includedFiles {
+		if file.root == "" {
+			root, path, err := resolveRoot(dir, file.includedPath)
+			if err != nil {
+				return nil, &Error{Pos: file.pos, Err: err}
+			}
+			file.root, file.includedPath = root, path
+		}
+
+		if filepath.IsAbs(file.includedPath) {
+			return nil, &Error{Pos: file.pos, Err: errors.New("only supports relative include paths")}
 		}
 
-		value, err := strconv.Unquote(lit.Value)
+		_, err := os.Stat(filepath.Join(file.root, file.includedPath))
 		if err != nil {
-			log.Fatalln("cannot unquote string:", err)
+			return nil, &Error{Pos: file.pos, Err: err}
 		}
 
-		switch sel.Sel.Name {
-		case "Include":
-			includedFiles = append(includedFiles, includedFile{
-				goFile:       currentGoFile,
-				includedPath: value,
-			})
-		case "IncludeFromFile":
-			includedFiles = includeFromFile(value, currentGoFile, includedFiles)
+		file.includedPath = strings.TrimPrefix(file.includedPath, "./")
+		includedFiles[i] = file
+	}
+
+	return includedFiles, nil
+}
+
+// expandIncluded replaces the calls of IncludeGlob and IncludeFromFile
+// with the files they match.
+func expandIncluded(dir string, includedFiles []includedFile) ([]includedFile, error) {
+	var expanded []includedFile
+	for _, file := range includedFiles {
+		var (
+			files []includedFile
+			err   error
+		)
+
+		expand := file.expand
+		file.expand = ""
+
+		switch expand {
 		case "IncludeGlob":
-			includedFiles = includeGlob(value, currentGoFile, includedFiles)
+			files, err = includeGlob(dir, file.includedPath, file)
+		case "IncludeFromFile":
+			files, err = includeFromFile(dir, file.includedPath, file)
+		default:
+			files = []includedFile{file}
+		}
+		if err != nil {
+			return nil, &Error{Pos: file.pos, Err: err}
 		}
 
-		return true
+		expanded = append(expanded, files...)
 	}
 
-	for path, file := range pkg.Files {
-		currentGoFile = path
-		ast.Inspect(file, visit)
+	return expanded, nil
+}
+
+// includeCall returns the files included by the binclude function name called by call,
+// file holds the go file and the position of the call.
+func includeCall(info *types.Info, call *ast.CallExpr, name, dir string, file includedFile) ([]includedFile, error) {
+	value, err := stringArg(info, call, 0)
+	if err != nil {
+		return nil, err
 	}
 
-	for i, file := range includedFiles {
-		var err error
+	switch name {
+	case "IncludeAs":
+		file.target, err = stringArg(info, call, 1)
+		if err != nil {
+			return nil, err
+		}
+		fallthrough
+	case "Include":
+		file.includedPath = value
+		return []includedFile{file}, nil
+	case "IncludeURL":
+		if file.sha256, err = stringArg(info, call, 1); err != nil {
+			return nil, err
+		}
 
-		if filepath.IsAbs(file.includedPath) {
-			return nil, errors.New("only supports relative include paths")
+		file.url = value
+		file.target = binclude.IncludeURL(value, file.sha256)
+		if target, ok := binclude.CleanPath(file.target); !ok || target == "." {
+			return nil, errors.New("cannot derive a file name from the url: " + value)
+		}
+		return []includedFile{file}, nil
+	case "IncludeCommand":
+		file.command = []string{value}
+		for i := 1; i < len(call.Args); i++ {
+			arg, err := stringArg(info, call, i)
+			if err != nil {
+				return nil, err
+			}
+			file.command = append(file.command, arg)
+		}
+
+		file.target = binclude.IncludeCommand(value, file.command[1:]...)
+		return []includedFile{file}, nil
+	case "IncludeArchive":
+		prefix, err := stringArg(info, call, 1)
+		if err != nil {
+			return nil, err
 		}
 
-		_, err = os.Stat(file.includedPath)
+		file.archive = true
+		file.includedPath = value
+		if file.target, _ = binclude.CleanPath(binclude.IncludeArchive(value, prefix)); file.target == "" {
+			return nil, errors.New("prefix points outside of the FileSystem: " + prefix)
+		}
+		return []includedFile{file}, nil
+	case "IncludeModule":
+		path, err := stringArg(info, call, 1)
 		if err != nil {
 			return nil, err
 		}
+		return includeModule(dir, value, path, file)
+	case "IncludeFromFile", "IncludeGlob":
+		// expanded by resolveIncluded, the files may be created by a command
+		file.expand = name
+		file.includedPath = value
+		return []includedFile{file}, nil
+	}
+
+	return nil, nil
+}
 
-		includedFiles[i].includedPath = strings.TrimPrefix(file.includedPath, "./")
+// stringArg returns the value of the i-th argument of call, which has to be
+// a constant string expression like "./assets", a const or "web/" + dist.
+func stringArg(info *types.Info, call *ast.CallExpr, i int) (string, error) {
+	if len(call.Args) <= i {
+		return "", fmt.Errorf("missing argument %d", i+1)
 	}
 
-	return includedFiles, nil
+	value, ok := constString(info, call.Args[i])
+	if !ok {
+		return "", fmt.Errorf("argument %d is not a constant string: %s", i+1, types.ExprString(call.Args[i]))
+	}
+
+	return value, nil
 }
 
-func includeFromFile(value, currentGoFile string, includedFiles []includedFile) []includedFile {
-	content, err := ioutil.ReadFile(value)
+func includeFromFile(dir, value string, file includedFile) ([]includedFile, error) {
+	root, value, err := resolveRoot(dir, value)
 	if err != nil {
-		log.Fatalln("cannot read includefile:", value, "err:", err)
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(root, value))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read includefile: %v", err)
 	}
 
 	paths := strings.Split(string(content), "\n")
@@ -257,29 +694,61 @@ func includeFromFile(value, currentGoFile string, includedFiles []includedFile)
 		}
 	}
 
+	var includedFiles []includedFile
 	for _, path := range paths {
-		includedFiles = append(includedFiles, includedFile{
-			goFile:       currentGoFile,
-			includedPath: path,
-		})
+		file.includedPath = path
+		includedFiles = append(includedFiles, file)
 	}
 
-	return includedFiles
+	return includedFiles, nil
 }
 
-func includeGlob(pattern, currentGoFile string, includedFiles []includedFile) []includedFile {
-	matches, err := filepath.Glob(pattern)
+func includeGlob(dir, pattern string, file includedFile) ([]includedFile, error) {
+	root, rootPattern, err := resolveRoot(dir, pattern)
 	if err != nil {
-		log.Fatalln("cannot glob:", pattern, "err:", err)
+		return nil, err
 	}
 
+	matches, err := filepath.Glob(filepath.Join(root, rootPattern))
+	if err != nil {
+		return nil, fmt.Errorf("cannot glob %s: %v", pattern, err)
+	}
+
+	file.root = root
+
+	var includedFiles []includedFile
 	for _, match := range matches {
-		includedFiles = append(includedFiles, includedFile{
-			goFile:       currentGoFile,
-			includedPath: match,
-		})
+		rel, err := filepath.Rel(root, match)
+		if err != nil {
+			return nil, err
+		}
+
+		file.includedPath = rel
+		includedFiles = append(includedFiles, file)
 	}
-	return includedFiles
+
+	return includedFiles, nil
+}
+
+// includeModule includes path relative to the root of the module modPath,
+// the files are available under modPath joined with path.
+func includeModule(dir, modPath, path string, file includedFile) ([]includedFile, error) {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(clean) || strings.HasPrefix(path, "//") || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return nil, errors.New("module path has to be relative to the module root: " + path)
+	}
+
+	mod, err := listModule(dir, modPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file.root = mod.Dir
+	file.module = mod
+	file.includedPath = clean
+	file.target = pathpkg.Join(mod.Path, filepath.ToSlash(clean))
+
+	return []includedFile{file}, nil
 }
 
 func remove(slice []string, s int) []string {
@@ -287,24 +756,33 @@ func remove(slice []string, s int) []string {
 }
 
 func createFile(fs *binclude.FileSystem, path string, file *binclude.File) error {
-	dir := filepath.Dir(path)
-	_, err := fs.Stat(dir)
-	if err != nil {
-		mkdir(fs, dir, os.ModePerm)
-	}
-
 	path = strings.TrimPrefix(path, "./")
+
+	mkdirAll(fs, pathpkg.Dir(path), os.ModePerm, file.ModTime)
+
 	fs.Files[path] = file
 	return nil
 }
 
-func mkdir(fs *binclude.FileSystem, name string, perm os.FileMode) {
+// mkdirAll creates the directory name and all missing parents except the root directory.
+func mkdirAll(fs *binclude.FileSystem, name string, perm os.FileMode, modTime time.Time) {
+	for name != "." && name != "/" {
+		if _, ok := fs.Files[name]; ok {
+			return
+		}
+
+		mkdir(fs, name, perm, modTime)
+		name = pathpkg.Dir(name)
+	}
+}
+
+func mkdir(fs *binclude.FileSystem, name string, perm os.FileMode, modTime time.Time) {
 	name = strings.TrimPrefix(name, "./")
 
 	fs.Files[name] = &binclude.File{
-		Filename: filepath.Base(name),
+		Filename: pathpkg.Base(name),
 		Mode:     os.ModeDir | perm,
-		ModTime:  time.Now(),
+		ModTime:  modTime,
 		Content:  nil,
 	}
 }
@@ -1,12 +1,30 @@
 package bincludegen_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
+	"fmt"
+	"go/format"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/lu4p/binclude"
 	"github.com/lu4p/binclude/bincludegen"
 	"github.com/rogpeppe/go-internal/gotooltest"
 	"github.com/rogpeppe/go-internal/testscript"
@@ -81,3 +99,720 @@ func bincmp(ts *testscript.TestScript, neg bool, args []string) {
 			args[0], args[1], sizeDiff)
 	}
 }
+
+func TestFlagsNotRegistered(t *testing.T) {
+	// tools importing bincludegen may define the same flags
+	for _, name := range []string{"o", "j", "config", "gzip", "check"} {
+		if flag.Lookup(name) != nil {
+			t.Errorf("flag -%s is registered on flag.CommandLine", name)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.go":          mainGo(`binclude.Include("./assets")`),
+		"assets/asset.txt": "asset",
+	}
+
+	writeFiles(t, dir, files)
+
+	res, err := bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Files) != 1 || res.Files[0].Name != "binclude.go" || !strings.Contains(string(res.Files[0].Content), `"assets/asset.txt"`) {
+		t.Fatal("unexpected generated files:", res.Files)
+	}
+
+	if _, err := os.Stat(res.Files[0].Path); !os.IsNotExist(err) {
+		t.Fatal("Generate wrote to disk:", err)
+	}
+
+	var paths []string
+	for _, asset := range res.Manifest.Assets {
+		paths = append(paths, asset.Path)
+	}
+
+	if res.Manifest.Package != "main" || strings.Join(paths, " ") != "assets assets/asset.txt" {
+		t.Fatal("unexpected manifest:", res.Manifest)
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "binclude.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := mainGo(`binclude.Include("./nonexisting")`, `binclude.Include(path)`)
+
+	for line, content := range map[int]string{6: strings.Replace(invalid, "(path)", `("./assets")`, 1), 7: invalid} {
+		writeFiles(t, dir, map[string]string{"main.go": content})
+
+		_, err = bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir})
+
+		var genErr *bincludegen.Error
+		if !errors.As(err, &genErr) || genErr.Pos.Line != line || filepath.Base(genErr.Pos.Filename) != "main.go" {
+			t.Errorf("expected error in line %d got: %v", line, err)
+		}
+	}
+}
+
+func TestGenerateCompression(t *testing.T) {
+	dir := t.TempDir()
+
+	main := mainGo(`binclude.Include("./asset.txt")`)
+	writeFiles(t, dir, map[string]string{"main.go": main, "asset.txt": "asset"})
+
+	cfg := &bincludegen.Config{Compression: "gzip"}
+	for compress, want := range map[*binclude.Compression]string{nil: "Compression: 1", compression(binclude.None): "Compression: 0"} {
+		res, err := bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir, Config: cfg, Compression: compress})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(res.Files[0].Content), want) {
+			t.Errorf("expected %s in the generated code", want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	main := mainGo(`binclude.Include("./asset.txt")`)
+	writeFiles(t, dir, map[string]string{"main.go": main, "asset.txt": "asset"})
+
+	res, err := bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir, Incremental: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the manifest is up to date, but the generated code is stale
+	generated := filepath.Join(dir, "binclude.go")
+	code, err := ioutil.ReadFile(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = []byte(strings.Replace(string(code), `"asset"`, `"stale"`, 1))
+	if err := ioutil.WriteFile(generated, code, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// neither option may compare the generated files on disk with themselves
+	for _, opts := range []bincludegen.Options{{Dir: dir}, {Dir: dir, Stream: true}, {Dir: dir, Incremental: true}} {
+		changes, err := bincludegen.Check(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(changes) != 1 || changes[0].Path != "asset.txt" {
+			t.Errorf("stream=%t incremental=%t: expected a change of asset.txt, got %v", opts.Stream, opts.Incremental, changes)
+		}
+	}
+
+	// the code around the assets is compared too
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, map[string]string{"main.go": strings.Replace(main, "package main", "package other", 1)})
+
+	changes, err := bincludegen.Check(context.Background(), bincludegen.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 1 || changes[0].String() != "~ binclude.go" {
+		t.Errorf("expected a change of the package clause, got %v", changes)
+	}
+}
+
+func TestGenerateIncremental(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.go":           mainGo(`binclude.Include("./assets")`),
+		"assets/asset1.txt": "asset1",
+		"assets/asset2.txt": "asset2",
+	}
+
+	writeFiles(t, dir, files)
+
+	opts := bincludegen.Options{Dir: dir, Incremental: true}
+
+	res, err := bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Unchanged {
+		t.Fatal("first generation is unchanged")
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the encoded content of unchanged files is taken from the generated file
+	generated := filepath.Join(dir, "binclude.go")
+	code, err := ioutil.ReadFile(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = []byte(strings.Replace(string(code), `"asset2"`, `"cached"`, 1))
+	if err := ioutil.WriteFile(generated, code, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Unchanged || !strings.Contains(string(res.Files[0].Content), `"cached"`) {
+		t.Fatal("unchanged inputs were regenerated")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "assets/asset1.txt"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := string(res.Files[0].Content)
+	if res.Unchanged || !strings.Contains(content, `"changed"`) || !strings.Contains(content, `"cached"`) {
+		t.Fatal("expected only the changed file to be encoded again:", content)
+	}
+
+	opts.Incremental = false
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(res.Files[0].Content), `"cached"`) {
+		t.Fatal("non incremental generation reused content")
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new mtime changes the ModTime in the generated code
+	opts.Incremental = true
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "assets/asset1.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Unchanged || !strings.Contains(string(res.Files[0].Content), fmt.Sprintf("time.Unix(%d, ", modTime.Unix())) {
+		t.Fatal("the new mtime is missing in the generated code")
+	}
+
+	// with reproducible ModTimes only the manifest is written
+	opts.Config = &bincludegen.Config{Reproducible: true}
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime = modTime.Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "assets/asset1.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Unchanged {
+		t.Fatal("only the mtime changed, but the result isn't unchanged")
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := ioutil.ReadFile(res.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(manifest), modTime.Format(time.RFC3339)) {
+		t.Fatal("the source mtime in the manifest wasn't updated:", string(manifest))
+	}
+
+	// a renamed package is regenerated
+	writeFiles(t, dir, map[string]string{"main.go": strings.Replace(files["main.go"], "package main", "package other", 1)})
+
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Unchanged || !strings.Contains(string(res.Files[0].Content), "package other") {
+		t.Fatal("the package clause wasn't regenerated")
+	}
+}
+
+func TestGenerateStream(t *testing.T) {
+	dir := t.TempDir()
+
+	var binary []byte
+	for i := 0; i < 1<<17; i++ {
+		binary = append(binary, byte(i*7))
+	}
+
+	files := map[string]string{
+		"main.go": mainGo(`binclude.Include("./assets")`),
+		// larger than the buffer of io.Copy, so runes are split between writes
+		"assets/utf8.txt":   strings.Repeat("ä€😀\"\\\n", 1<<14),
+		"assets/binary.bin": string(binary),
+		"assets/image.png":  "png",
+		"assets/data.json":  "{\n  \"a\": 1\n}\n",
+		"assets/empty.txt":  "",
+	}
+
+	writeFiles(t, dir, files)
+
+	for _, compress := range []binclude.Compression{binclude.None, binclude.Gzip} {
+		opts := bincludegen.Options{
+			Dir:         dir,
+			Compression: compression(compress),
+			Config:      &bincludegen.Config{Minify: true},
+		}
+
+		res, err := bincludegen.Generate(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := res.Files[0].Content
+
+		formatted, err := format.Source(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(formatted, want) {
+			t.Fatal("generated code is not gofmt'ed")
+		}
+
+		opts.Stream = true
+		res, err = bincludegen.Generate(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Files[0].Content != nil || res.Report != nil {
+			t.Fatal("streamed Result holds the generated code")
+		}
+
+		if err := res.Write(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadFile(res.Files[0].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Fatal("streamed code differs with compression", compress)
+		}
+
+		if res.Report == nil || res.Report.FileSystems[0].CompressedSize == 0 {
+			t.Fatal("missing report after Write")
+		}
+	}
+}
+
+func TestGenerateJobs(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{"main.go": mainGo(`binclude.Include("./assets")`, `binclude.IncludeAs("./assets/0", "0")`)}
+	for i := 0; i < 100; i++ {
+		files["assets/"+strconv.Itoa(i%5)+"/"+strconv.Itoa(i)+".txt"] = strings.Repeat(strconv.Itoa(i), i)
+	}
+
+	writeFiles(t, dir, files)
+
+	opts := bincludegen.Options{Dir: dir, Compression: compression(binclude.Gzip), Jobs: 1}
+	want, err := bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, jobs := range []int{2, 8, 64} {
+		opts.Jobs = jobs
+		got, err := bincludegen.Generate(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got.Files[0].Content, want.Files[0].Content) {
+			t.Fatal("generated code differs with jobs", jobs)
+		}
+	}
+
+	opts.Config = &bincludegen.Config{MaxFileSize: 150}
+	if _, err := bincludegen.Generate(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "assets/0/80.txt is larger") {
+		t.Fatal("expected the first too large file in walk order, got", err)
+	}
+}
+
+func TestGenerateURL(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("BINCLUDE_CACHE", filepath.Join(dir, "cache"))
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/js/lib.js":
+			w.Write([]byte("lib"))
+		case "/font.txt":
+			w.Write([]byte("font"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	libSum := sha256.Sum256([]byte("lib"))
+	fontSum := sha256.Sum256([]byte("font"))
+
+	main := mainGo(
+		`binclude.IncludeURL("`+srv.URL+`/js/lib.js?v=1", "`+hex.EncodeToString(libSum[:])+`")`,
+		`binclude.IncludeURL("`+srv.URL+`/font.txt", "")`,
+	)
+	writeFiles(t, dir, map[string]string{"main.go": main})
+
+	res, err := bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := string(res.Files[0].Content)
+	if !strings.Contains(content, `"lib.js"`) || !strings.Contains(content, `[]byte("font")`) {
+		t.Fatal("fetched files are missing:", content)
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := ioutil.ReadFile(filepath.Join(dir, bincludegen.LockName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(lock), srv.URL+"/font.txt "+hex.EncodeToString(fontSum[:])) {
+		t.Fatal("hash isn't pinned in the lockfile:", string(lock))
+	}
+
+	// a deleted lockfile is written again, even if nothing changed
+	opts := bincludegen.Options{Dir: dir, Incremental: true}
+	lockPath := filepath.Join(dir, bincludegen.LockName)
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(lockPath); !res.Unchanged || err != nil {
+		t.Fatal("the lockfile of an unchanged result wasn't written:", res.Unchanged, err)
+	}
+
+	writeFiles(t, dir, map[string]string{"main.go": strings.Replace(main, hex.EncodeToString(libSum[:]), strings.Repeat("0", 64), 1)})
+
+	_, err = bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir})
+
+	var genErr *bincludegen.Error
+	if !errors.As(err, &genErr) || genErr.Pos.Line != 6 || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatal("expected a sha256 mismatch in line 6, got:", err)
+	}
+
+	// the cache is used offline, files are found by their hash
+	srv.Close()
+	requests = 0
+
+	writeFiles(t, dir, map[string]string{"main.go": strings.Replace(main, "/js/lib.js", "/js/moved.js", 1)})
+
+	res, err = bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 0 || !strings.Contains(string(res.Files[0].Content), `"moved.js"`) {
+		t.Fatal("cached files were fetched again")
+	}
+
+	// without binclude.IncludeURL the lockfile is removed
+	writeFiles(t, dir, map[string]string{"main.go": mainGo(`binclude.Include("./main.go")`)})
+
+	res, err = bincludegen.Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := res.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatal("the stale lockfile wasn't removed:", err)
+	}
+}
+
+func TestGenerateArchive(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	files := []struct {
+		name string
+		mode os.FileMode
+		body string
+	}{
+		{"web", os.ModeDir | 0o755, ""},
+		{"web/index.html", 0o644, "<html></html>"},
+		{"bin/tool", 0o755, "#!/bin/sh"},
+	}
+
+	writeTar := func(w io.Writer) error {
+		tw := tar.NewWriter(w)
+		for _, f := range files {
+			hdr, err := tar.FileInfoHeader(fileInfo{f.name, f.mode, int64(len(f.body)), modTime}, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = f.name
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+
+			if _, err := tw.Write([]byte(f.body)); err != nil {
+				return err
+			}
+		}
+
+		return tw.Close()
+	}
+
+	archives := map[string]func(w io.Writer) error{
+		"dist.tar": writeTar,
+		"dist.tar.gz": func(w io.Writer) error {
+			gw := gzip.NewWriter(w)
+			if err := writeTar(gw); err != nil {
+				return err
+			}
+			return gw.Close()
+		},
+		"dist.tar.zst": func(w io.Writer) error {
+			zw, err := zstd.NewWriter(w)
+			if err != nil {
+				return err
+			}
+
+			if err := writeTar(zw); err != nil {
+				return err
+			}
+			return zw.Close()
+		},
+		"dist.zip": func(w io.Writer) error {
+			zw := zip.NewWriter(w)
+			for _, f := range files {
+				hdr, err := zip.FileInfoHeader(fileInfo{f.name, f.mode, int64(len(f.body)), modTime})
+				if err != nil {
+					return err
+				}
+				hdr.Name = f.name
+				if f.mode.IsDir() {
+					hdr.Name += "/"
+				}
+
+				fw, err := zw.CreateHeader(hdr)
+				if err != nil {
+					return err
+				}
+
+				if _, err := fw.Write([]byte(f.body)); err != nil {
+					return err
+				}
+			}
+
+			return zw.Close()
+		},
+	}
+
+	for name, write := range archives {
+		var b bytes.Buffer
+		if err := write(&b); err != nil {
+			t.Fatal(name, err)
+		}
+
+		writeFiles(t, dir, map[string]string{
+			name:      b.String(),
+			"main.go": mainGo(`binclude.IncludeArchive("./` + name + `", "static")`),
+		})
+
+		res, err := bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir, Compression: compression(binclude.Gzip)})
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		assets := make(map[string]bincludegen.Asset)
+		for _, asset := range res.Manifest.Assets {
+			assets[asset.Path] = asset
+		}
+
+		for _, f := range files {
+			asset, ok := assets["static/"+f.name]
+			if !ok || asset.Mode != f.mode || !asset.ModTime.Equal(modTime) || asset.Size != int64(len(f.body)) {
+				t.Errorf("%s: unexpected asset %s: %+v", name, f.name, asset)
+			}
+		}
+
+		if !strings.Contains(string(res.Files[0].Content), `"static/bin/tool"`) {
+			t.Error(name, "file is missing in the generated code")
+		}
+	}
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	tw.WriteHeader(&tar.Header{Name: "../evil.txt", Mode: 0o644, Typeflag: tar.TypeReg})
+	tw.Close()
+
+	writeFiles(t, dir, map[string]string{
+		"dist.tar": b.String(),
+		"main.go":  mainGo(`binclude.IncludeArchive("./dist.tar", "")`),
+	})
+
+	_, err := bincludegen.Generate(context.Background(), bincludegen.Options{Dir: dir})
+
+	var genErr *bincludegen.Error
+	if !errors.As(err, &genErr) || genErr.Pos.Line != 6 || !strings.Contains(err.Error(), "outside of the archive") {
+		t.Fatal("expected a path traversal error in line 6, got:", err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("GOOS", "linux")
+	t.Setenv("GOARCH", "amd64")
+
+	files := map[string]string{
+		"main.go":         mainGo(`binclude.Include("./assets")`),
+		"main_linux.go":   strings.Replace(mainGo(`binclude.Include("./linux.txt")`), "func main", "func init", 1),
+		"main_windows.go": strings.Replace(mainGo(`binclude.Include("./windows.txt")`), "func main", "func init", 1),
+		"assets/a.txt":    strings.Repeat("a", 1000),
+		"linux.txt":       "linux",
+		"windows.txt":     "windows",
+		"exe":             "not really an executable",
+	}
+
+	writeFiles(t, dir, files)
+
+	exe := filepath.Join(dir, "exe")
+	opts := bincludegen.Options{Dir: dir, Compression: compression(binclude.Gzip)}
+	if err := bincludegen.Append(context.Background(), opts, exe); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := binclude.OpenZip(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"assets/a.txt": files["assets/a.txt"], "linux.txt": "linux"} {
+		content, err := fs.ReadFile(name)
+		if err != nil || string(content) != want {
+			t.Errorf("%s: got %q, %v want %q", name, content, err, want)
+		}
+	}
+
+	if _, err := fs.Stat("windows.txt"); !os.IsNotExist(err) {
+		t.Error("file for another platform was appended:", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "binclude.go")); !os.IsNotExist(err) {
+		t.Error("go code was written:", err)
+	}
+}
+
+// writeFiles writes files by their slash separated path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// mainGo returns the source of a main package whose main function makes the binclude calls,
+// the first call is in line 6.
+func mainGo(calls ...string) string {
+	return "package main\n\nimport \"github.com/lu4p/binclude\"\n\nfunc main() {\n\t" + strings.Join(calls, "\n\t") + "\n}\n"
+}
+
+// compression returns a pointer to c for Options.Compression.
+func compression(c binclude.Compression) *binclude.Compression {
+	return &c
+}
+
+// fileInfo a os.FileInfo to create archive headers.
+type fileInfo struct {
+	name    string
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+}
+
+func (f fileInfo) Name() string       { return filepath.Base(f.name) }
+func (f fileInfo) Size() int64        { return f.size }
+func (f fileInfo) Mode() os.FileMode  { return f.mode }
+func (f fileInfo) ModTime() time.Time { return f.modTime }
+func (f fileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f fileInfo) Sys() interface{}   { return nil }
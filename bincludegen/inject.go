@@ -1,114 +1,243 @@
 package bincludegen
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"fmt"
-	"go/format"
-	"io/ioutil"
+	"io"
+	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"unicode/utf8"
 
 	"github.com/lu4p/binclude"
 )
 
-func generateCode(pkgName string, fs *binclude.FileSystem, buildTag string) *bytes.Buffer {
-	b := bytes.NewBuffer(nil)
+// streamSource a file whose content is streamed from disk while the code is written.
+type streamSource struct {
+	path string
+	// encodedSize is set to the size of the encoded content
+	encodedSize *int64
+}
+
+// generateFiles returns the generated files of all FileSystems. The content of
+// files in sources (by build tag and path) is streamed from disk when the
+// generated file is written, if sources is nil the code is generated in memory.
+// The versions of the included modules are listed in the header.
+func generateFiles(dir, pkgName string, fileSystems map[string]*binclude.FileSystem, cfg *Config, modules []string, sources map[string]map[string]streamSource) ([]GeneratedFile, error) {
+	var files []GeneratedFile
+	for buildTag, fs := range fileSystems {
+		buildTag, fs := buildTag, fs
+
+		name := cfg.output(buildTag)
+		file := GeneratedFile{
+			Name: name,
+			Path: filepath.Join(dir, name),
+			write: func(w io.Writer) error {
+				return writeCode(w, pkgName, fs, buildTag, cfg.variable(), modules, sources[buildTag])
+			},
+		}
+
+		if sources == nil {
+			var b bytes.Buffer
+			if err := file.write(&b); err != nil {
+				return nil, err
+			}
+			file.Content = b.Bytes()
+		}
+
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
 
-	header := `// Code generated by https://github.com/lu4p/binclude; DO NOT EDIT.
+	return files, nil
+}
 
-package ` + pkgName + "\n"
+// writeCode writes the code of a FileSystem, the code is written
+// like gofmt would format it, so it doesn't need to be parsed by go/format.
+func writeCode(w io.Writer, pkgName string, fs *binclude.FileSystem, buildTag, variable string, modules []string, sources map[string]streamSource) error {
+	b := bufio.NewWriter(w)
 
-	b.WriteString(header)
+	b.WriteString("// Code generated by https://github.com/lu4p/binclude; DO NOT EDIT.\n")
+	if len(modules) > 0 {
+		b.WriteString("//\n// Included modules:\n")
+		for _, mod := range modules {
+			b.WriteString("//\t" + mod + "\n")
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString("package " + pkgName + "\n\n")
 
 	b.WriteString("import (\n")
-	b.WriteString("\"github.com/lu4p/binclude\"\n")
+	b.WriteString("\t\"github.com/lu4p/binclude\"\n")
 	if len(fs.Files) > 0 {
-		b.WriteString("\"time\"\n")
+		b.WriteString("\t\"time\"\n")
 	}
-	b.WriteString(")\n")
+	b.WriteString(")\n\n")
 
-	fsName := "BinFS"
+	fsName := variable
 	if buildTag != "default" {
 		fsName = "_binfs" + buildTag
 	}
 
-	fsCode(fs, b, fsName)
+	if err := fsCode(fs, b, fsName, sources); err != nil {
+		return err
+	}
 
-	return b
+	initFunc := `
+func init() {
+	` + variable + `.Reindex()
 }
+`
+	if buildTag != "default" {
+		initFunc = `
+func init() {
+	` + variable + `.Lock()
+	for path, file := range ` + fsName + `.Files {
+		` + variable + `.Files[path] = file
+	}
+	` + variable + `.Unlock()
+	` + variable + `.Reindex()
+}
+`
+	}
+	b.WriteString(initFunc)
 
-func generateFiles(dir, pkgName string, fileSystems map[string]*binclude.FileSystem) error {
-	for buildTag, fs := range fileSystems {
-		code := generateFile(pkgName, fs, buildTag)
+	return b.Flush()
+}
 
-		path := filepath.Join(dir, "binclude"+buildTag+".go")
-		if buildTag == "default" {
-			path = filepath.Join(dir, "binclude.go")
-		}
+func fsCode(fs *binclude.FileSystem, b *bufio.Writer, fsName string, sources map[string]streamSource) error {
+	fmt.Fprintf(b, "var %s = &binclude.FileSystem{Files: binclude.Files{", fsName)
+	if len(fs.Files) > 0 {
+		b.WriteString("\n")
+	}
 
-		if err := writeCodeToFile(path, code); err != nil {
+	var paths []string
+	for path := range fs.Files {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		file := fs.Files[path]
+		if err := fileCode(file, b, path, sources); err != nil {
 			return err
 		}
 	}
-	return nil
+
+	_, err := b.WriteString("}}\n")
+	return err
 }
 
-func generateFile(pkgName string, fs *binclude.FileSystem, buildTag string) []byte {
-	b := generateCode(pkgName, fs, buildTag)
+func fileCode(f *binclude.File, b *bufio.Writer, path string, sources map[string]streamSource) error {
+	fmt.Fprintf(b, "\t%q: {\n", path)
 
-	if buildTag == "default" {
-		return b.Bytes()
-	}
+	fmt.Fprintf(b, "\t\tFilename: %q, Mode: %O, ModTime: time.Unix(%d, %d), Compression: %d,\n",
+		f.Filename, f.Mode, f.ModTime.Unix(), f.ModTime.Nanosecond(), f.Compression)
 
-	initFunc := `
-func init() {
-	BinFS.Lock()
-	for path, file := range _binfs` + buildTag + `.Files {
-		BinFS.Files[path] = file
+	if src, ok := sources[path]; ok {
+		b.WriteString("\t\tContent: []byte(\"")
+		if err := streamContent(b, src, f.Compression); err != nil {
+			return err
+		}
+		b.WriteString("\"),\n")
+	} else if f.Content != nil {
+		fmt.Fprintf(b, "\t\tContent: []byte(%q),\n", f.Content)
 	}
-	BinFS.Unlock()
-}`
 
-	b.WriteString(initFunc)
-	return b.Bytes()
+	_, err := b.WriteString("\t},\n")
+	return err
 }
 
-func writeCodeToFile(filename string, code []byte) error {
-	fmtCode, err := format.Source([]byte(code))
+// streamContent writes the content of the file at src.path compressed
+// with compression as the body of a string literal to b.
+func streamContent(b *bufio.Writer, src streamSource, compression binclude.Compression) error {
+	f, err := os.Open(src.path)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	return ioutil.WriteFile(filename, fmtCode, 0o666)
-}
+	q := &quoteWriter{w: b}
 
-func fsCode(fs *binclude.FileSystem, b *bytes.Buffer, fsName string) {
-	fmt.Fprintf(b, "var %s = &binclude.FileSystem{Files: binclude.Files{\n", fsName)
+	var w io.WriteCloser = q
+	if compression == binclude.Gzip {
+		w = gzip.NewWriter(q)
+	}
 
-	var paths []string
-	for path := range fs.Files {
-		paths = append(paths, path)
+	if _, err := io.Copy(w, f); err != nil {
+		return err
 	}
 
-	sort.Strings(paths)
+	if err := w.Close(); err != nil {
+		return err
+	}
 
-	for _, path := range paths {
-		file := fs.Files[path]
-		fileCode(file, b, path)
+	if compression == binclude.Gzip {
+		if err := q.Close(); err != nil {
+			return err
+		}
 	}
 
-	b.WriteString("}}\n")
+	*src.encodedSize = q.n
+	return nil
+}
+
+// quoteWriter writes everything written to it as the body of a
+// Go string literal, the same way strconv.Quote would quote it.
+type quoteWriter struct {
+	w *bufio.Writer
+	// n the number of bytes written to the quoteWriter
+	n int64
+	// tail an incomplete utf8 sequence at the end of the last write
+	tail []byte
+	buf  []byte
 }
 
-func fileCode(f *binclude.File, b *bytes.Buffer, path string) {
-	fmt.Fprintf(b, "%q:{\n", path)
+func (q *quoteWriter) Write(p []byte) (int, error) {
+	q.n += int64(len(p))
+
+	data := append(q.tail, p...)
 
-	fmt.Fprintf(b, `Filename: %q, Mode: %O, ModTime: time.Unix(%d,%d), Compression: %d,`,
-		f.Filename, f.Mode, f.ModTime.Unix(), f.ModTime.UnixNano(), f.Compression)
+	// keep an incomplete rune for the next write,
+	// so it is quoted the same as in one piece
+	keep := 0
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				keep = len(data) - i
+			}
+			break
+		}
+	}
+
+	if err := q.quote(data[:len(data)-keep]); err != nil {
+		return 0, err
+	}
+
+	q.tail = append(q.tail[:0:0], data[len(data)-keep:]...)
+	return len(p), nil
+}
+
+// Close writes the remaining bytes.
+func (q *quoteWriter) Close() error {
+	err := q.quote(q.tail)
+	q.tail = nil
+	return err
+}
 
-	if f.Content != nil {
-		fmt.Fprintf(b, "\nContent: []byte(%q),", f.Content)
+func (q *quoteWriter) quote(data []byte) error {
+	if len(data) == 0 {
+		return nil
 	}
 
-	b.WriteString("\n},\n")
+	q.buf = strconv.AppendQuote(q.buf[:0], string(data))
+	_, err := q.w.Write(q.buf[1 : len(q.buf)-1])
+	return err
 }
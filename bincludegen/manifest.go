@@ -0,0 +1,181 @@
+package bincludegen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lu4p/binclude"
+)
+
+// manifestName returns the name of the manifest file written next to the generated files.
+func (cfg *Config) manifestName() string {
+	return strings.TrimSuffix(cfg.output("default"), ".go") + ".manifest.json"
+}
+
+// optionsKey describes all settings which change the generated code,
+// if it differs from the one in the manifest everything is regenerated.
+// Transformers passed via Options are only compared by pattern and type.
+func optionsKey(cfg *Config, compress binclude.Compression, transforms []Transform, modules []string) string {
+	var names []string
+	for _, t := range transforms {
+		names = append(names, fmt.Sprintf("%s=%T", t.Pattern, t.Transformer))
+	}
+
+	return fmt.Sprintf("compression=%d minify=%t transforms=%q exclude=%q output=%q variable=%q reproducible=%t transformers=%q modules=%q",
+		compress, cfg.Minify, cfg.Transforms, cfg.Exclude, cfg.output("default"), cfg.variable(), cfg.Reproducible, names, modules)
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hex encoded sha256 hash of the file at path
+// without reading it into memory.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// buildTag returns the build tag of the FileSystem the asset is included in.
+func (a Asset) buildTag() string {
+	if a.Platform == "" {
+		return "default"
+	}
+
+	return "_" + a.Platform
+}
+
+// previous the manifest and generated files of the last generation,
+// used to skip reading and encoding unchanged files.
+type previous struct {
+	dir    string
+	cfg    *Config
+	assets map[string]Asset
+	// mu guards files, it is used by the workers concurrently
+	mu sync.Mutex
+	// files the parsed generated files by build tag, parsed on first use
+	files map[string]binclude.Files
+}
+
+// loadPrevious reads the manifest in dir, it returns nil if there is
+// no manifest or it was written with different options or for another package.
+func loadPrevious(dir string, cfg *Config, pkgName, options string) *previous {
+	data, err := ioutil.ReadFile(filepath.Join(dir, cfg.manifestName()))
+	if err != nil {
+		return nil
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Options != options || manifest.Package != pkgName {
+		return nil
+	}
+
+	prev := &previous{
+		dir:    dir,
+		cfg:    cfg,
+		assets: make(map[string]Asset),
+		files:  make(map[string]binclude.Files),
+	}
+
+	for _, asset := range manifest.Assets {
+		prev.assets[asset.Platform+"\x00"+asset.Path] = asset
+	}
+
+	return prev
+}
+
+// asset returns the previous manifest entry of the file at path.
+func (p *previous) asset(platform, path string) (Asset, bool) {
+	if p == nil {
+		return Asset{}, false
+	}
+
+	asset, ok := p.assets[platform+"\x00"+path]
+	return asset, ok
+}
+
+// unmodified reports whether the file on disk has the same size, mtime and mode as before,
+// in that case it isn't read again.
+func (a Asset) unmodified(source string, info os.FileInfo) bool {
+	return a.Source == source && a.Mode == info.Mode() &&
+		a.SourceSize == info.Size() && a.SourceModTime.Equal(info.ModTime())
+}
+
+// file returns the previously generated file at path,
+// its Content is encoded with the previous compression.
+func (p *previous) file(buildTag, path string) (*binclude.File, bool) {
+	if p == nil {
+		return nil, false
+	}
+
+	p.mu.Lock()
+	files, ok := p.files[buildTag]
+	if !ok {
+		files, _ = parseGeneratedFile(filepath.Join(p.dir, p.cfg.output(buildTag)), nil)
+		p.files[buildTag] = files // nil if the file is missing or invalid
+	}
+	p.mu.Unlock()
+
+	file, ok := files[path]
+	return file, ok
+}
+
+// readGenerated reads the generated files of an unchanged package from disk,
+// if stream is set they are only read when they are written.
+func readGenerated(dir string, cfg *Config, buildTags []string, stream bool) ([]GeneratedFile, error) {
+	var files []GeneratedFile
+	for _, buildTag := range buildTags {
+		name := cfg.output(buildTag)
+		file := GeneratedFile{Name: name, Path: filepath.Join(dir, name)}
+
+		if stream {
+			if _, err := os.Stat(file.Path); err != nil {
+				return nil, err
+			}
+
+			file.write = func(w io.Writer) error {
+				f, err := os.Open(file.Path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				_, err = io.Copy(w, f)
+				return err
+			}
+		} else {
+			var err error
+			if file.Content, err = ioutil.ReadFile(file.Path); err != nil {
+				return nil, err
+			}
+		}
+
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	return files, nil
+}
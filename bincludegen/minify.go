@@ -0,0 +1,581 @@
+package bincludegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// The built in minifiers are conservative, they only remove comments and whitespace.
+// They don't parse their input, minifyJS recognizes regular expression
+// literals by the preceding character or keyword like jsmin does.
+
+// minifyJSON removes insignificant whitespace from JSON.
+func minifyJSON(path string, content []byte) ([]byte, error) {
+	var b bytes.Buffer
+	if err := json.Compact(&b, content); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// minifyCSS removes comments and collapses whitespace in CSS,
+// whitespace around {, }, ;, ',' and > and around the colons of
+// declarations is removed completely.
+func minifyCSS(path string, content []byte) ([]byte, error) {
+	const separators = "{};,>"
+
+	b := make([]byte, 0, len(content))
+	space := false
+	depth := 0
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		switch {
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 3
+			space = true
+
+		case isSpace(c):
+			space = true
+
+		default:
+			// inside a block a colon separates a property from its value,
+			// outside it may be part of a selector like "a :hover"
+			afterColon := depth > 0 && len(b) > 0 && b[len(b)-1] == ':'
+			beforeColon := depth > 0 && c == ':' && isDeclaration(content[i:])
+			if space && len(b) > 0 && !afterColon && !beforeColon &&
+				strings.IndexByte(separators, b[len(b)-1]) < 0 &&
+				strings.IndexByte(separators, c) < 0 {
+				b = append(b, ' ')
+			}
+			space = false
+
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+
+			if c == '}' && len(b) > 0 && b[len(b)-1] == ';' {
+				b = b[:len(b)-1]
+			}
+
+			if c != '"' && c != '\'' {
+				b = append(b, c)
+				continue
+			}
+
+			end, err := stringEnd(content, i)
+			if err != nil {
+				return nil, err
+			}
+			b = append(b, content[i:end]...)
+			i = end - 1
+		}
+	}
+
+	return b, nil
+}
+
+// isDeclaration reports whether rest is the rest of a declaration like "color: red",
+// not of a selector in a nested block like "@media print { a :hover {".
+func isDeclaration(rest []byte) bool {
+	end := bytes.IndexAny(rest, "{;}")
+	return end < 0 || rest[end] != '{'
+}
+
+// stringEnd returns the index after the end of the quoted string starting at start.
+func stringEnd(content []byte, start int) (int, error) {
+	quote := content[start]
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1, nil
+		}
+	}
+
+	return 0, errors.New("unterminated string")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// minifyHTML removes comments and collapses whitespace in HTML,
+// the content of pre, textarea, script and style elements is kept as is.
+func minifyHTML(path string, content []byte) ([]byte, error) {
+	return minifyMarkup(content, []string{"pre", "textarea", "script", "style"}, nil)
+}
+
+// minifySVG removes comments and whitespace only text between tags in SVG,
+// whitespace inside of text elements is collapsed, the content of
+// script and style elements is kept as is.
+func minifySVG(path string, content []byte) ([]byte, error) {
+	return minifyMarkup(content, []string{"script", "style"}, []string{"text"})
+}
+
+// minifyMarkup removes comments and collapses whitespace in HTML and XML.
+// The content of rawTags is copied as is.
+// If textTags is non-nil whitespace only text outside of textTags is removed.
+func minifyMarkup(content []byte, rawTags, textTags []string) ([]byte, error) {
+	b := make([]byte, 0, len(content))
+	textDepth := 0
+
+	for i := 0; i < len(content); {
+		switch {
+		case bytes.HasPrefix(content[i:], []byte("<!--")):
+			end := bytes.Index(content[i+4:], []byte("-->"))
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+
+			comment := content[i : i+4+end+3]
+			if bytes.HasPrefix(comment, []byte("<!--[if")) || bytes.HasPrefix(comment, []byte("<!--<![endif]")) {
+				b = append(b, comment...) // keep conditional comments
+			}
+			i += len(comment)
+
+		case bytes.HasPrefix(content[i:], []byte("<![CDATA[")):
+			end := bytes.Index(content[i:], []byte("]]>"))
+			if end < 0 {
+				return nil, errors.New("unterminated CDATA section")
+			}
+			b = append(b, content[i:i+end+3]...)
+			i += end + 3
+
+		case isTagStart(content, i):
+			end, err := tagEnd(content, i)
+			if err != nil {
+				return nil, err
+			}
+
+			tag := content[i:end]
+			name, closing := tagName(tag)
+			b = appendTag(b, tag)
+			i = end
+
+			if hasTag(textTags, name) {
+				if closing {
+					textDepth--
+				} else if !bytes.HasSuffix(tag, []byte("/>")) {
+					textDepth++
+				}
+			}
+
+			if closing || !hasTag(rawTags, name) || bytes.HasSuffix(tag, []byte("/>")) {
+				continue
+			}
+
+			// copy the content of raw elements up to the closing tag
+			rawEnd := indexFold(content[i:], "</"+name)
+			if rawEnd < 0 {
+				return nil, errors.New("unterminated " + name + " element")
+			}
+			b = append(b, content[i:i+rawEnd]...)
+			i += rawEnd
+
+		default:
+			end := i + 1
+			for end < len(content) && !isTagStart(content, end) {
+				end++
+			}
+
+			text := content[i:end]
+			i = end
+
+			if len(b) > 0 && isSpace(b[len(b)-1]) {
+				// whitespace which followed a removed comment
+				text = bytes.TrimLeft(text, " \t\r\n\f")
+			}
+
+			if textTags != nil && textDepth == 0 && len(bytes.TrimSpace(text)) == 0 {
+				continue
+			}
+
+			b = appendCollapsed(b, text)
+		}
+	}
+
+	return b, nil
+}
+
+// isTagStart reports whether a tag, comment or declaration starts at i.
+func isTagStart(content []byte, i int) bool {
+	if content[i] != '<' || i+1 >= len(content) {
+		return false
+	}
+
+	c := content[i+1]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '/' || c == '!' || c == '?'
+}
+
+// tagEnd returns the index after the end of the tag starting at start,
+// quoted attribute values may contain >.
+func tagEnd(content []byte, start int) (int, error) {
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '"', '\'':
+			end := bytes.IndexByte(content[i+1:], content[i])
+			if end < 0 {
+				return 0, errors.New("unterminated attribute value")
+			}
+			i += end + 1
+		case '>':
+			return i + 1, nil
+		}
+	}
+
+	return 0, errors.New("unterminated tag")
+}
+
+// tagName returns the lower case name of a tag and whether it is a closing tag.
+func tagName(tag []byte) (string, bool) {
+	tag = bytes.TrimPrefix(tag, []byte("<"))
+	closing := bytes.HasPrefix(tag, []byte("/"))
+	tag = bytes.TrimPrefix(tag, []byte("/"))
+
+	end := bytes.IndexAny(tag, " \t\n\r\f/>")
+	if end < 0 {
+		end = len(tag)
+	}
+
+	return string(bytes.ToLower(tag[:end])), closing
+}
+
+func hasTag(tags []string, name string) bool {
+	for _, tag := range tags {
+		if tag == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// indexFold returns the index of the first case insensitive occurrence of sep in s.
+func indexFold(s []byte, sep string) int {
+	return bytes.Index(bytes.ToLower(s), []byte(sep))
+}
+
+// appendTag appends tag to b, whitespace outside of attribute values is collapsed.
+func appendTag(b, tag []byte) []byte {
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := bytes.IndexByte(tag[i+1:], c) // tagEnd guarantees that the value is terminated
+			b = append(b, tag[i:i+end+2]...)
+			i += end + 1
+		case isSpace(c):
+			for i+1 < len(tag) && isSpace(tag[i+1]) {
+				i++
+			}
+
+			if tag[i+1] != '>' {
+				b = append(b, ' ')
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return b
+}
+
+// appendCollapsed appends text to b, runs of whitespace are replaced
+// by a newline if they contain one, otherwise by a space.
+func appendCollapsed(b, text []byte) []byte {
+	for i := 0; i < len(text); i++ {
+		if !isSpace(text[i]) {
+			b = append(b, text[i])
+			continue
+		}
+
+		sep := byte(' ')
+		for ; i < len(text) && isSpace(text[i]); i++ {
+			if text[i] == '\n' {
+				sep = '\n'
+			}
+		}
+		i--
+
+		b = append(b, sep)
+	}
+
+	return b
+}
+
+// minifyJS removes comments and insignificant whitespace from JavaScript,
+// it is a port of Douglas Crockford's jsmin which also recognizes regular
+// expression literals after keywords like return and typeof.
+func minifyJS(path string, content []byte) ([]byte, error) {
+	m := jsmin{in: content, a: '\n', lookahead: eof, x: eof, y: eof}
+	if err := m.run(); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimLeft(m.out, "\n"), nil
+}
+
+const eof = -1
+
+// jsmin holds the state of the minifier.
+type jsmin struct {
+	in, out   []byte
+	pos       int
+	a, b      int
+	lookahead int
+	x, y      int
+}
+
+func isAlphanum(c int) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' ||
+		c == '_' || c == '$' || c == '\\' || c > 126
+}
+
+// get returns the next character, control characters except newlines are turned into spaces.
+func (m *jsmin) get() int {
+	c := m.lookahead
+	m.lookahead = eof
+
+	if c == eof {
+		if m.pos >= len(m.in) {
+			return eof
+		}
+		c = int(m.in[m.pos])
+		m.pos++
+	}
+
+	if c >= ' ' || c == '\n' || c == eof {
+		return c
+	}
+
+	if c == '\r' {
+		return '\n'
+	}
+
+	return ' '
+}
+
+func (m *jsmin) peek() int {
+	m.lookahead = m.get()
+	return m.lookahead
+}
+
+// next returns the next character excluding comments.
+func (m *jsmin) next() (int, error) {
+	c := m.get()
+	if c == '/' {
+		switch m.peek() {
+		case '/':
+			for c > '\n' {
+				c = m.get()
+			}
+		case '*':
+			m.get()
+			for c != ' ' {
+				switch m.get() {
+				case '*':
+					if m.peek() == '/' {
+						m.get()
+						c = ' '
+					}
+				case eof:
+					return 0, errors.New("unterminated comment")
+				}
+			}
+		}
+	}
+
+	m.y = m.x
+	m.x = c
+	return c, nil
+}
+
+func (m *jsmin) put(c int) {
+	m.out = append(m.out, byte(c))
+}
+
+// action 1: output a, copy b to a, get the next b
+// action 2: copy b to a, get the next b (delete a)
+// action 3: get the next b (delete b)
+func (m *jsmin) action(d int) error {
+	var err error
+
+	if d <= 1 {
+		m.put(m.a)
+		if (m.y == '\n' || m.y == ' ') &&
+			(m.a == '+' || m.a == '-' || m.a == '*' || m.a == '/') &&
+			(m.b == '+' || m.b == '-' || m.b == '*' || m.b == '/') {
+			m.put(m.y)
+		}
+	}
+
+	if d <= 2 {
+		m.a = m.b
+		if m.a == '\'' || m.a == '"' || m.a == '`' {
+			for {
+				m.put(m.a)
+				m.a = m.get()
+				if m.a == m.b {
+					break
+				}
+				if m.a == '\\' {
+					m.put(m.a)
+					m.a = m.get()
+				}
+				if m.a == eof {
+					return errors.New("unterminated string literal")
+				}
+			}
+		}
+	}
+
+	m.b, err = m.next()
+	if err != nil {
+		return err
+	}
+
+	if m.b != '/' || !bytes.ContainsRune([]byte("(,=:[!&|?+-~*/{};\n"), rune(m.a)) && !m.afterKeyword() {
+		return nil
+	}
+
+	// regular expression literal
+	m.put(m.a)
+	if m.a == '/' || m.a == '*' {
+		m.put(' ')
+	}
+	m.put(m.b)
+
+	for {
+		m.a = m.get()
+		if m.a == '[' {
+			for {
+				m.put(m.a)
+				m.a = m.get()
+				if m.a == ']' {
+					break
+				}
+				if m.a == '\\' {
+					m.put(m.a)
+					m.a = m.get()
+				}
+				if m.a == eof {
+					return errors.New("unterminated set in regular expression literal")
+				}
+			}
+		} else if m.a == '/' {
+			if c := m.peek(); c == '/' || c == '*' {
+				return errors.New("unterminated set in regular expression literal")
+			}
+			break
+		} else if m.a == '\\' {
+			m.put(m.a)
+			m.a = m.get()
+		}
+
+		if m.a == eof {
+			return errors.New("unterminated regular expression literal")
+		}
+		m.put(m.a)
+	}
+
+	m.b, err = m.next()
+	return err
+}
+
+// regexKeywords the keywords a regular expression literal can follow, a / after
+// them doesn't start a division.
+var regexKeywords = []string{"return", "typeof", "case", "do", "else", "in", "instanceof", "new", "delete", "void", "throw", "yield", "await"}
+
+// afterKeyword reports whether a is a space after one of regexKeywords,
+// property names like x.return are no keywords.
+func (m *jsmin) afterKeyword() bool {
+	if m.a != ' ' && m.a != '\n' {
+		return false
+	}
+
+	for _, keyword := range regexKeywords {
+		if !bytes.HasSuffix(m.out, []byte(keyword)) {
+			continue
+		}
+
+		before := len(m.out) - len(keyword)
+		if before == 0 || !isAlphanum(int(m.out[before-1])) && m.out[before-1] != '.' {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *jsmin) run() error {
+	if bytes.HasPrefix(m.in, []byte("\xef\xbb\xbf")) {
+		m.pos = 3 // skip byte order mark
+	}
+
+	if err := m.action(3); err != nil {
+		return err
+	}
+
+	for m.a != eof {
+		var d int
+
+		switch m.a {
+		case ' ':
+			d = 2
+			if isAlphanum(m.b) {
+				d = 1
+			}
+		case '\n':
+			switch m.b {
+			case '{', '[', '(', '+', '-', '!', '~':
+				d = 1
+			case ' ':
+				d = 3
+			default:
+				d = 2
+				if isAlphanum(m.b) {
+					d = 1
+				}
+			}
+		default:
+			switch m.b {
+			case ' ':
+				d = 3
+				if isAlphanum(m.a) {
+					d = 1
+				}
+			case '\n':
+				switch m.a {
+				case '}', ']', ')', '+', '-', '"', '\'', '`':
+					d = 1
+				default:
+					d = 3
+					if isAlphanum(m.a) {
+						d = 1
+					}
+				}
+			default:
+				d = 1
+			}
+		}
+
+		if err := m.action(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package bincludegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// module a module as printed by go list -m -json.
+type module struct {
+	Path    string
+	Version string
+	Dir     string
+	Replace *module
+}
+
+// String returns the module like it is written in go.mod.
+func (m *module) String() string {
+	s := strings.TrimSpace(m.Path + " " + m.Version)
+	if m.Replace != nil {
+		s += " => " + strings.TrimSpace(m.Replace.Path+" "+m.Replace.Version)
+	}
+
+	return s
+}
+
+// listModule resolves the module path required by the module in dir,
+// the module is downloaded if it isn't in the module cache yet.
+func listModule(dir, path string) (*module, error) {
+	var mod module
+	if err := goJSON(dir, &mod, "list", "-m", "-json", path); err != nil {
+		return nil, err
+	}
+
+	if mod.Dir == "" && mod.Replace != nil {
+		mod.Dir = mod.Replace.Dir
+	}
+
+	if mod.Dir == "" {
+		var download module
+		if err := goJSON(dir, &download, "mod", "download", "-json", mod.Path+"@"+mod.Version); err != nil {
+			return nil, err
+		}
+		mod.Dir = download.Dir
+	}
+
+	if mod.Dir == "" {
+		return nil, errors.New("cannot find the directory of module " + path)
+	}
+
+	return &mod, nil
+}
+
+// goJSON runs the go command with args in dir and decodes its output into v.
+func goJSON(dir string, v interface{}, args ...string) error {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return json.Unmarshal(stdout.Bytes(), v)
+}
+
+// moduleRoot returns the directory of the go.mod file of the module dir is part of.
+func moduleRoot(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for d := abs; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+
+		if d == filepath.Dir(d) {
+			return "", errors.New("cannot resolve module root path, no go.mod found in " + abs + " or its parents")
+		}
+	}
+}
+
+// resolveRoot returns the directory path is relative to and the path relative to it,
+// paths starting with // are relative to the module root, all others to dir.
+func resolveRoot(dir, path string) (string, string, error) {
+	if !strings.HasPrefix(path, "//") {
+		return dir, path, nil
+	}
+
+	root, err := moduleRoot(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	return root, "./" + strings.TrimLeft(path, "/"), nil
+}
+
+// includedModules returns the modules files are included from, sorted and without duplicates.
+func includedModules(includedFiles []includedFile) []string {
+	seen := make(map[string]bool)
+
+	var modules []string
+	for _, file := range includedFiles {
+		if file.module == nil || seen[file.module.String()] {
+			continue
+		}
+
+		seen[file.module.String()] = true
+		modules = append(modules, file.module.String())
+	}
+
+	sort.Strings(modules)
+	return modules
+}
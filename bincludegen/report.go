@@ -0,0 +1,179 @@
+package bincludegen
+
+import (
+	"fmt"
+	"io"
+	pathpkg "path"
+	"sort"
+	"text/tabwriter"
+)
+
+// Report the sizes of the generated FileSystems.
+type Report struct {
+	FileSystems []FSReport `json:"filesystems"`
+}
+
+// FSReport the sizes of the files included into a FileSystem.
+type FSReport struct {
+	// Platform the GOOS and/ or GOARCH of the FileSystem, empty for all platforms.
+	Platform string `json:"platform,omitempty"`
+	Files    int    `json:"files"`
+	// RawSize the size after all transforms were applied,
+	// CompressedSize the size of the content in the generated code.
+	RawSize        int64 `json:"raw_size"`
+	CompressedSize int64 `json:"compressed_size"`
+	// Ratio CompressedSize / RawSize.
+	Ratio float64 `json:"ratio"`
+	// Dirs every directory with the sizes of all files below it, largest first.
+	Dirs []SizeReport `json:"dirs"`
+	// Largest the largest files by compressed size.
+	Largest []SizeReport `json:"largest"`
+}
+
+// SizeReport the sizes of a file or directory.
+type SizeReport struct {
+	Path           string `json:"path"`
+	Files          int    `json:"files"`
+	RawSize        int64  `json:"raw_size"`
+	CompressedSize int64  `json:"compressed_size"`
+}
+
+// newReport creates the Report of the assets, the top
+// largest files are listed for every FileSystem.
+func newReport(assets []Asset, top int) *Report {
+	reports := make(map[string]*FSReport)
+	dirs := make(map[string]map[string]*SizeReport)
+	files := make(map[string][]SizeReport)
+
+	for _, asset := range assets {
+		if asset.Mode.IsDir() {
+			continue
+		}
+
+		size := SizeReport{
+			Path:           asset.Path,
+			Files:          1,
+			RawSize:        asset.Size,
+			CompressedSize: asset.EncodedSize,
+		}
+
+		r := reports[asset.Platform]
+		if r == nil {
+			r = &FSReport{Platform: asset.Platform}
+			reports[asset.Platform] = r
+			dirs[asset.Platform] = make(map[string]*SizeReport)
+		}
+
+		r.Files++
+		r.RawSize += size.RawSize
+		r.CompressedSize += size.CompressedSize
+		files[asset.Platform] = append(files[asset.Platform], size)
+
+		for dir := pathpkg.Dir(asset.Path); dir != "." && dir != "/"; dir = pathpkg.Dir(dir) {
+			d := dirs[asset.Platform][dir]
+			if d == nil {
+				d = &SizeReport{Path: dir}
+				dirs[asset.Platform][dir] = d
+			}
+
+			d.Files++
+			d.RawSize += size.RawSize
+			d.CompressedSize += size.CompressedSize
+		}
+	}
+
+	var report Report
+	for platform, r := range reports {
+		for _, d := range dirs[platform] {
+			r.Dirs = append(r.Dirs, *d)
+		}
+		sortSizes(r.Dirs)
+
+		r.Ratio = ratio(r.CompressedSize, r.RawSize)
+
+		r.Largest = files[platform]
+		sortSizes(r.Largest)
+		if len(r.Largest) > top {
+			r.Largest = r.Largest[:top]
+		}
+
+		report.FileSystems = append(report.FileSystems, *r)
+	}
+
+	sort.Slice(report.FileSystems, func(i, j int) bool {
+		return report.FileSystems[i].Platform < report.FileSystems[j].Platform
+	})
+
+	return &report
+}
+
+// sortSizes sorts by compressed size, largest first.
+func sortSizes(sizes []SizeReport) {
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].CompressedSize != sizes[j].CompressedSize {
+			return sizes[i].CompressedSize > sizes[j].CompressedSize
+		}
+		return sizes[i].Path < sizes[j].Path
+	})
+}
+
+// WriteText writes a human readable report to w,
+// listing at most top directories and files per FileSystem.
+func (r *Report) WriteText(w io.Writer, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+
+	for _, fs := range r.FileSystems {
+		platform := fs.Platform
+		if platform == "" {
+			platform = "all platforms"
+		}
+
+		fmt.Fprintf(tw, "%s: %d files, %s raw, %s compressed (%.1f%%)\n",
+			platform, fs.Files, formatSize(fs.RawSize), formatSize(fs.CompressedSize), 100*fs.Ratio)
+
+		for _, list := range []struct {
+			title string
+			sizes []SizeReport
+		}{{"largest directories", fs.Dirs}, {"largest files", fs.Largest}} {
+			if len(list.sizes) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(tw, "  %s:\n", list.title)
+			for i, size := range list.sizes {
+				if i == top {
+					break
+				}
+
+				fmt.Fprintf(tw, "\t%s\t%s\t%.1f%%\t  %s\n", formatSize(size.RawSize),
+					formatSize(size.CompressedSize), 100*ratio(size.CompressedSize, size.RawSize), size.Path)
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+func ratio(compressed, raw int64) float64 {
+	if raw == 0 {
+		return 1
+	}
+
+	return float64(compressed) / float64(raw)
+}
+
+// formatSize formats size with a decimal unit like 1.5 MB.
+func formatSize(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,199 @@
+package bincludegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/lu4p/binclude"
+)
+
+// Result the outcome of Generate, nothing is written to disk until Write is called.
+type Result struct {
+	// Files the generated go files sorted by name.
+	Files []GeneratedFile
+	// Manifest describes the included files.
+	Manifest Manifest
+	// ManifestPath the path the manifest is written to.
+	ManifestPath string
+	// LockPath the path the lockfile is written to,
+	// if any files are included via binclude.IncludeURL.
+	LockPath string
+	// Unchanged is true if Options.Incremental is set and no input changed
+	// since the last generation, Files holds the files on disk then.
+	Unchanged bool
+	// Report the sizes of the included files, if Options.Stream
+	// is set the Report is only available after Write.
+	Report *Report
+
+	top         int
+	lock        []byte
+	fileSystems map[string]*binclude.FileSystem
+	// sourceChanged whether the manifest of an Unchanged Result has to be
+	// written, because the size or mtime of a file on disk changed
+	sourceChanged bool
+}
+
+// GeneratedFile a generated go file.
+type GeneratedFile struct {
+	// Name the file name, e.g. binclude.go or binclude_linux.go.
+	Name string
+	// Path the path the file is written to, it is Name joined with Options.Dir.
+	Path string
+	// Content the gofmt'ed source code, nil if Options.Stream is set,
+	// then the code is only generated by WriteTo.
+	Content []byte
+
+	write func(w io.Writer) error
+}
+
+// WriteTo writes the source code to w.
+func (f *GeneratedFile) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	var err error
+	if f.Content != nil || f.write == nil {
+		_, err = cw.Write(f.Content)
+	} else {
+		err = f.write(cw)
+	}
+
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Manifest describes the files included into the FileSystems of a package.
+type Manifest struct {
+	// Package the name of the package.
+	Package string `json:"package"`
+	// Options describes the settings the files were generated with.
+	Options string `json:"options"`
+	// Assets sorted by Platform and Path.
+	Assets []Asset `json:"assets"`
+}
+
+// Asset a file or directory included into a FileSystem.
+type Asset struct {
+	// Path the path in the FileSystem.
+	Path string `json:"path"`
+	// Source the path on disk relative to Options.Dir.
+	Source string `json:"source"`
+	// Platform the GOOS and/ or GOARCH the file is included on, e.g. linux_amd64,
+	// empty for files included on all platforms.
+	Platform string `json:"platform,omitempty"`
+	// Size the size after all transforms were applied but before compression.
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+	// EncodedSize the size of the content in the generated code.
+	EncodedSize int64 `json:"encoded_size"`
+	// SHA256 the hex encoded hash of the file on disk, empty for directories.
+	SHA256 string `json:"sha256,omitempty"`
+	// SourceSize and SourceModTime of the file on disk.
+	SourceSize    int64     `json:"source_size"`
+	SourceModTime time.Time `json:"source_mod_time"`
+}
+
+// Write writes the generated files, the lockfile and the manifest to disk.
+// If the Result is Unchanged only the manifest is written if the mtime of a file
+// changed, so the file isn't hashed again on the next generation. The lockfile
+// is always written and removed if no files are included via binclude.IncludeURL.
+func (r *Result) Write() error {
+	if err := r.writeLock(); err != nil {
+		return err
+	}
+
+	if r.Unchanged {
+		if r.sourceChanged {
+			return r.writeManifest()
+		}
+
+		return nil
+	}
+
+	for _, file := range r.Files {
+		if err := writeFile(file); err != nil {
+			return err
+		}
+	}
+
+	if r.Report == nil {
+		r.Report = newReport(r.Manifest.Assets, r.top)
+	}
+
+	return r.writeManifest()
+}
+
+// writeLock writes the lockfile if it differs from the one on disk.
+func (r *Result) writeLock() error {
+	if r.lock == nil {
+		if err := os.Remove(r.LockPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	if old, err := ioutil.ReadFile(r.LockPath); err == nil && bytes.Equal(old, r.lock) {
+		return nil
+	}
+
+	return ioutil.WriteFile(r.LockPath, r.lock, 0o666)
+}
+
+func (r *Result) writeManifest() error {
+	manifest, err := json.MarshalIndent(r.Manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.ManifestPath, append(manifest, '\n'), 0o666)
+}
+
+func writeFile(file GeneratedFile) error {
+	f, err := os.OpenFile(file.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Error an error caused by a binclude call in the package source.
+type Error struct {
+	// Pos the position of the call.
+	Pos token.Position
+	Err error
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Err.Error()
+	}
+
+	return e.Pos.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
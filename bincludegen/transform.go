@@ -0,0 +1,165 @@
+package bincludegen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lu4p/binclude"
+)
+
+// Transformer transforms the content of a file before it is included,
+// the path of the file in the FileSystem stays the same.
+type Transformer interface {
+	Transform(path string, content []byte) ([]byte, error)
+}
+
+// TransformerFunc is an adapter to allow the use of ordinary functions as Transformer.
+type TransformerFunc func(path string, content []byte) ([]byte, error)
+
+// Transform calls f(path, content).
+func (f TransformerFunc) Transform(path string, content []byte) ([]byte, error) {
+	return f(path, content)
+}
+
+// Transform applies a Transformer to all files matching Pattern.
+type Transform struct {
+	// Pattern is either a file extension like ".css" or a pattern like "web/**/*.js"
+	// with the syntax of binclude.Match, which is matched against the path in the FileSystem.
+	Pattern string
+	Transformer
+}
+
+// matches reports whether the transform should be applied to the file at path.
+func (t Transform) matches(path string) (bool, error) {
+	if strings.HasPrefix(t.Pattern, ".") && !strings.ContainsAny(t.Pattern, "/*?[\\") {
+		return strings.HasSuffix(path, t.Pattern), nil
+	}
+
+	return binclude.Match(t.Pattern, path)
+}
+
+// transform applies all matching transforms in order to the content of the file at path.
+func transform(transforms []Transform, path string, content []byte) ([]byte, error) {
+	for _, t := range transforms {
+		ok, err := t.matches(path)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s: %v", t.Pattern, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		content, err = t.Transform(path, content)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s: %v", path, err)
+		}
+	}
+
+	return content, nil
+}
+
+// matchesAny reports whether any of the transforms is applied to the file at path.
+func matchesAny(transforms []Transform, path string) (bool, error) {
+	for _, t := range transforms {
+		ok, err := t.matches(path)
+		if err != nil {
+			return false, fmt.Errorf("transform %s: %v", t.Pattern, err)
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+var (
+	transformers = map[string]Transformer{
+		"css":  TransformerFunc(minifyCSS),
+		"js":   TransformerFunc(minifyJS),
+		"json": TransformerFunc(minifyJSON),
+		"svg":  TransformerFunc(minifySVG),
+		"html": TransformerFunc(minifyHTML),
+	}
+	transformersMu sync.RWMutex
+)
+
+// RegisterTransformer makes a Transformer available under name,
+// so that it can be selected with the -transform flag.
+// The built in minifiers are registered as css, js, json, svg and html.
+func RegisterTransformer(name string, t Transformer) {
+	transformersMu.Lock()
+	transformers[name] = t
+	transformersMu.Unlock()
+}
+
+// LookupTransformer returns the Transformer registered under name.
+func LookupTransformer(name string) (Transformer, bool) {
+	transformersMu.RLock()
+	defer transformersMu.RUnlock()
+
+	t, ok := transformers[name]
+	return t, ok
+}
+
+// Minify returns Transforms which minify CSS, JS, JSON, SVG and HTML files
+// selected by their file extension.
+func Minify() []Transform {
+	return []Transform{
+		{Pattern: ".css", Transformer: TransformerFunc(minifyCSS)},
+		{Pattern: ".js", Transformer: TransformerFunc(minifyJS)},
+		{Pattern: ".json", Transformer: TransformerFunc(minifyJSON)},
+		{Pattern: ".svg", Transformer: TransformerFunc(minifySVG)},
+		{Pattern: ".html", Transformer: TransformerFunc(minifyHTML)},
+		{Pattern: ".htm", Transformer: TransformerFunc(minifyHTML)},
+	}
+}
+
+// ParseTransform parses a transform in the form pattern=name[,name...],
+// e.g. ".css=css" or "web/**/*.js=js,license", the names are looked up
+// with LookupTransformer and applied in order.
+func ParseTransform(s string) ([]Transform, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return nil, errors.New("transform has to be in the form pattern=name: " + s)
+	}
+
+	pattern, names := s[:i], strings.Split(s[i+1:], ",")
+
+	if _, err := (Transform{Pattern: pattern}).matches(""); err != nil {
+		return nil, fmt.Errorf("transform %s: %v", pattern, err)
+	}
+
+	var transforms []Transform
+	for _, name := range names {
+		t, ok := LookupTransformer(strings.TrimSpace(name))
+		if !ok {
+			return nil, errors.New("unknown transformer: " + name)
+		}
+
+		transforms = append(transforms, Transform{Pattern: pattern, Transformer: t})
+	}
+
+	return transforms, nil
+}
+
+// transformFlag implements flag.Value for the -transform flag,
+// the transforms are validated while parsing the flags.
+type transformFlag []string
+
+func (f *transformFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *transformFlag) Set(value string) error {
+	if _, err := ParseTransform(value); err != nil {
+		return err
+	}
+
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,79 @@
+package bincludegen_test
+
+import (
+	"testing"
+
+	"github.com/lu4p/binclude/bincludegen"
+)
+
+func TestMinify(t *testing.T) {
+	tests := []struct {
+		transformer, in, want string
+	}{
+		{"json", "{\n  \"a\": [1, 2],\n  \"b\": \"c d\"\n}\n", `{"a":[1,2],"b":"c d"}`},
+		{"css", "/* comment */\nbody {\n  color : red;\n  margin: 0 auto;\n}\n\na > b, c { content: \"a  ;  }\"; }\n",
+			`body{color:red;margin:0 auto}a>b,c{content:"a  ;  }"}`},
+		{"css", "a :hover { color : red }\n@media print {\n  a :hover { margin : 0 }\n}\n",
+			`a :hover{color:red}@media print{a :hover{margin:0}}`},
+		{"js", "// comment\nvar a = 1 + +b; /* comment */\nfunction f(x) {\n  return x.replace(/\\/\\//g, \"a  b\");\n}\n",
+			"var a=1+ +b;function f(x){return x.replace(/\\/\\//g,\"a  b\");}"},
+		{"js", "function f(s) {\n  return /a  b/.test(s) && typeof /c  d/ != x.return / 2 / y;\n}\n",
+			"function f(s){return /a  b/.test(s)&&typeof /c  d/!=x.return/2/y;}"},
+		{"js", "var s = `a\n   b`;\nvar c = a\n++b\n", "var s=`a\n   b`;var c=a\n++b"},
+		{"html", "<!DOCTYPE html>\n<html>\n  <!-- comment -->\n  <body   class=\"a  b\" >\n    <p>Hello   world</p>\n    <pre>  keep\n  this  </pre>\n  </body>\n</html>\n",
+			"<!DOCTYPE html>\n<html>\n<body class=\"a  b\">\n<p>Hello world</p>\n<pre>  keep\n  this  </pre>\n</body>\n</html>\n"},
+		{"svg", "<?xml version=\"1.0\"?>\n<!-- comment -->\n<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <g>\n    <text x=\"1\">Hello   <tspan>world</tspan></text>\n  </g>\n</svg>\n",
+			"<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\"><g><text x=\"1\">Hello <tspan>world</tspan></text></g></svg>"},
+	}
+
+	for _, test := range tests {
+		transformer, ok := bincludegen.LookupTransformer(test.transformer)
+		if !ok {
+			t.Fatal("transformer is not registered:", test.transformer)
+		}
+
+		got, err := transformer.Transform("file", []byte(test.in))
+		if err != nil {
+			t.Fatal(test.transformer, err)
+		}
+
+		if string(got) != test.want {
+			t.Errorf("%s: got %q want %q", test.transformer, got, test.want)
+		}
+	}
+
+	invalid := map[string]string{
+		"json": "{",
+		"css":  "/* comment",
+		"js":   "var a = 'b",
+		"html": "<p class=\"a>",
+	}
+
+	for name, in := range invalid {
+		transformer, _ := bincludegen.LookupTransformer(name)
+		if _, err := transformer.Transform("file", []byte(in)); err == nil {
+			t.Errorf("%s: invalid input was accepted: %q", name, in)
+		}
+	}
+}
+
+func TestParseTransform(t *testing.T) {
+	bincludegen.RegisterTransformer("upper", bincludegen.TransformerFunc(func(path string, content []byte) ([]byte, error) {
+		return []byte("UPPER"), nil
+	}))
+
+	transforms, err := bincludegen.ParseTransform("web/**/*.js=js,upper")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transforms) != 2 || transforms[0].Pattern != "web/**/*.js" {
+		t.Fatal("unexpected transforms:", transforms)
+	}
+
+	for _, invalid := range []string{"", ".css", "=css", ".css=", ".css=nonexistent", "[=css"} {
+		if _, err := bincludegen.ParseTransform(invalid); err == nil {
+			t.Error("invalid transform was accepted:", invalid)
+		}
+	}
+}
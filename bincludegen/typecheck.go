@@ -0,0 +1,113 @@
+package bincludegen
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	pathpkg "path"
+	"sort"
+	"strings"
+)
+
+// bincludePath the import path of the binclude package.
+const bincludePath = "github.com/lu4p/binclude"
+
+// bincludeStub declares the binclude functions the generator looks for.
+const bincludeStub = `package binclude
+
+func Include(name string) string
+func IncludeAs(name, target string) string
+func IncludeGlob(pattern string) string
+func IncludeFromFile(name string)
+func IncludeModule(modPath, name string) string
+func IncludeURL(url, sha256 string) string
+func IncludeCommand(name string, args ...string) string
+func IncludeArchive(name, prefix string) string
+`
+
+// typeCheck type checks pkg to evaluate constant expressions and resolve
+// the binclude calls, the errors are ignored since the generated files
+// and the imported packages are missing.
+func typeCheck(fset *token.FileSet, pkg *ast.Package) *types.Info {
+	var names []string
+	for name := range pkg.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var files []*ast.File
+	for _, name := range names {
+		files = append(files, pkg.Files[name])
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+
+	conf := types.Config{
+		Importer: stubImporter{},
+		Error:    func(error) {},
+	}
+	conf.Check(pkg.Name, fset, files, info)
+
+	return info
+}
+
+// stubImporter imports every package except binclude as an empty package, so
+// packages don't have to be built to type check the package of the binclude calls.
+type stubImporter struct{}
+
+func (stubImporter) Import(path string) (*types.Package, error) {
+	if path == bincludePath {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "binclude.go", bincludeStub, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return (&types.Config{}).Check(path, fset, []*ast.File{f}, nil)
+	}
+
+	name := pathpkg.Base(path)
+	if i := strings.LastIndex(name, ".v"); i > 0 {
+		name = name[:i] // gopkg.in/yaml.v2
+	}
+
+	pkg := types.NewPackage(path, name)
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// bincludeFunc returns the name of the binclude function called by call,
+// the function can be imported under any name or with a dot import.
+func bincludeFunc(info *types.Info, call *ast.CallExpr) (string, bool) {
+	var ident *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return "", false
+	}
+
+	fn, ok := info.Uses[ident].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != bincludePath {
+		return "", false
+	}
+
+	return fn.Name(), true
+}
+
+// constString returns the value of expr if it is a constant string.
+func constString(info *types.Info, expr ast.Expr) (string, bool) {
+	tv, ok := info.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+
+	return constant.StringVal(tv.Value), true
+}
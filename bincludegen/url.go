@@ -0,0 +1,252 @@
+package bincludegen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockName the name of the lockfile, it records the sha256 hashes of the files
+// included via binclude.IncludeURL, so they are only fetched once.
+const LockName = "binclude.lock"
+
+// lockfile the sha256 hashes by url, the hash is pinned by the first
+// download if the binclude.IncludeURL call has none.
+type lockfile map[string]string
+
+// readLock reads the lockfile in dir, a missing lockfile is empty.
+func readLock(dir string) (lockfile, error) {
+	lock := make(lockfile)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, LockName))
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 || !validHash(fields[1]) {
+			return nil, fmt.Errorf("%s:%d: invalid line, expected: url sha256", LockName, line)
+		}
+
+		lock[fields[0]] = fields[1]
+	}
+
+	return lock, s.Err()
+}
+
+// bytes returns the content of the lockfile, nil if it is empty.
+func (l lockfile) bytes() []byte {
+	if len(l) == 0 {
+		return nil
+	}
+
+	var urls []string
+	for rawurl := range l {
+		urls = append(urls, rawurl)
+	}
+	sort.Strings(urls)
+
+	var b bytes.Buffer
+	b.WriteString("# Code generated by https://github.com/lu4p/binclude; DO NOT EDIT.\n")
+	for _, rawurl := range urls {
+		b.WriteString(rawurl + " " + l[rawurl] + "\n")
+	}
+
+	return b.Bytes()
+}
+
+func validHash(sum string) bool {
+	b, err := hex.DecodeString(sum)
+	return err == nil && len(b) == sha256.Size
+}
+
+// cacheDir returns the directory the fetched files are stored in by their hash,
+// it is $BINCLUDE_CACHE or binclude in the user cache directory.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("BINCLUDE_CACHE"); dir != "" {
+		return dir, nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the cache directory, set BINCLUDE_CACHE: %v", err)
+	}
+
+	return filepath.Join(dir, "binclude"), nil
+}
+
+// fetchIncluded fetches the files included via binclude.IncludeURL into the cache,
+// it returns the lockfile with the hashes of the included urls.
+func fetchIncluded(ctx context.Context, dir string, includedFiles []includedFile, lock lockfile) (lockfile, error) {
+	used := make(lockfile)
+	for i, file := range includedFiles {
+		if file.url == "" {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		sum := file.sha256
+		if sum == "" {
+			sum = lock[file.url]
+		}
+
+		path, sum, err := fetchURL(ctx, dir, file.url, sum)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return nil, err
+		}
+
+		if err != nil {
+			return nil, &Error{Pos: file.pos, Err: err}
+		}
+
+		used[file.url] = sum
+		includedFiles[i].root, includedFiles[i].includedPath = filepath.Split(path)
+		includedFiles[i].source = file.url
+	}
+
+	return used, nil
+}
+
+// fetchURL returns the path of the file at rawurl in the cache and its hash,
+// it is only downloaded if the cache doesn't contain a file with the hash sum yet.
+// If sum is empty any content is accepted.
+func fetchURL(ctx context.Context, dir, rawurl, sum string) (string, string, error) {
+	sum = strings.ToLower(sum)
+	if sum != "" && !validHash(sum) {
+		return "", "", errors.New("invalid sha256 hash: " + sum)
+	}
+
+	cache, err := cacheDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	if sum != "" {
+		path := filepath.Join(cache, sum)
+		if cached, err := hashFile(path); err == nil && cached == sum {
+			return path, sum, nil
+		}
+	}
+
+	body, err := openURL(ctx, dir, rawurl)
+	if err != nil {
+		return "", "", err
+	}
+	defer body.Close()
+
+	path, sum, err := writeCache(cache, body, sum)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot fetch %s: %v", rawurl, err)
+	}
+
+	return path, sum, nil
+}
+
+// writeCache writes the content of r to the cache directory under its hash,
+// it returns the path of the file and the hash. If sum isn't empty the
+// content has to match it.
+func writeCache(cache string, r io.Reader, sum string) (string, string, error) {
+	if err := os.MkdirAll(cache, 0o755); err != nil {
+		return "", "", err
+	}
+
+	tmp, err := ioutil.TempFile(cache, "download-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	got := hex.EncodeToString(h.Sum(nil))
+	if sum != "" && got != sum {
+		return "", "", fmt.Errorf("sha256 mismatch: got %s, want %s", got, sum)
+	}
+
+	path := filepath.Join(cache, got)
+	if cached, err := hashFile(path); err == nil && cached == got {
+		return path, got, nil // keep the ModTime of the cached file
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", "", err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", "", err
+	}
+
+	return path, got, nil
+}
+
+// openURL opens an http, https or file URL,
+// relative file URLs like file:assets/a.txt are relative to dir.
+func openURL(ctx context.Context, dir, rawurl string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("cannot fetch %s: %s", rawurl, resp.Status)
+		}
+
+		return resp.Body, nil
+	case "file":
+		path := u.Path
+		if u.Opaque != "" {
+			path = filepath.Join(dir, filepath.FromSlash(u.Opaque))
+		}
+
+		return os.Open(filepath.FromSlash(path))
+	}
+
+	return nil, errors.New("unsupported url scheme: " + rawurl)
+}
@@ -3,107 +3,127 @@ package binexec
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strconv"
+	"path"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/lu4p/binclude"
+	"github.com/lu4p/binclude/internal/cache"
 )
 
+// ErrIntegrity is returned by Run and Start if the executable on the host
+// doesn't match the bincluded file or the supplied signature.
+var ErrIntegrity = cache.ErrIntegrity
+
 // Cmd same as Cmd in the os/exec package
 type Cmd struct {
 	OsCmd *exec.Cmd
 	// Cache if set to true the binary won't be deleted after execution.
 	// If the ModTime of the cached binclude file changes the cache gets invalidated automtically.
 	Cache bool
+	// PublicKey if set the executable is verified against Signature
+	// instead of the hash of the bincluded file before every execution.
+	PublicKey ed25519.PublicKey
+	// Signature the ed25519 signature of the executable, used with PublicKey.
+	Signature []byte
+
+	sum       [sha256.Size]byte
+	bincluded bool
+
+	script     []byte
+	scriptArgs []string
+	scriptName string
+	scriptPath string
 }
 
 // Command similar to Command in the os/exec package,
 // but copies the executeable to run from bincludePath
 // to the host os.
 func Command(fs *binclude.FileSystem, bincludePath string, arg ...string) (*Cmd, error) {
-	execPath, err := copyCommand(fs, bincludePath)
+	execPath, sum, err := cache.Copy(fs, bincludePath)
 	if err != nil {
 		return nil, err
 	}
 
 	cmd := Cmd{
-		OsCmd: exec.Command(execPath, arg...),
+		OsCmd:     exec.Command(execPath, arg...),
+		sum:       sum,
+		bincluded: true,
 	}
 
 	return &cmd, nil
 }
 
-// copyCommand copy a file from binclude.FileSystem to os.UserCacheDir()
-func copyCommand(fs *binclude.FileSystem, bincludePath string) (string, error) {
-	dir, _ := os.UserCacheDir()
-
-	info, err := fs.Stat(bincludePath)
-	if err != nil {
-		return "", err
-	}
-
-	nanoSec := strconv.Itoa(info.ModTime().Nanosecond())
-
-	namePart := "_" + filepath.Base(bincludePath)
-
-	execPath := filepath.Join(dir, nanoSec+namePart)
-
-	// exit early if file is already cached
-	_, err = os.Stat(execPath)
-	if err == nil {
-		return execPath, nil
+// verify checks the executable at c.OsCmd.Path against c.PublicKey
+// or against the hash of the bincluded file if no PublicKey is set.
+// Executables found on the host are not verified.
+func (c *Cmd) verify() error {
+	if !c.bincluded {
+		return nil
 	}
 
-	infos, err := ioutil.ReadDir(dir)
-	if err != nil {
-		return "", err
-	}
-
-	// remove invalidated cache files
-	for _, info := range infos {
-		if strings.HasSuffix(info.Name(), namePart) {
-			os.Remove(filepath.Join(dir, info.Name())) // don't check for error because we don't really care if the file is removed
-			// no break because there could be multiple cached versions
-		}
-	}
-
-	return execPath, fs.CopyFile(bincludePath, execPath)
+	return cache.Verify(c.OsCmd.Path, c.sum, c.PublicKey, c.Signature)
 }
 
 // CommandContext similar to CommandContext in the os/exec
 // package but copies the executeable to run from bincludePath
 // to the host os.
 func CommandContext(ctx context.Context, fs *binclude.FileSystem, bincludePath string, arg ...string) (*Cmd, error) {
-	execPath, err := copyCommand(fs, bincludePath)
+	execPath, sum, err := cache.Copy(fs, bincludePath)
 	if err != nil {
 		return nil, err
 	}
 
 	cmd := Cmd{
-		OsCmd: exec.CommandContext(ctx, execPath, arg...),
+		OsCmd:     exec.CommandContext(ctx, execPath, arg...),
+		sum:       sum,
+		bincluded: true,
 	}
 
 	return &cmd, nil
 }
 
 // Run is similar to (*Cmd).Run() in the os/exec package,
-// but deletes the executable at Cmd.Path if c.Cache is false
+// but verifies the executable before running it and
+// deletes the bincluded executable at Cmd.Path if c.Cache is false
 func (c *Cmd) Run() error {
-	if !c.Cache {
-		defer os.Remove(c.OsCmd.Path)
+	if err := c.Start(); err != nil {
+		if c.bincluded && !c.Cache {
+			os.Remove(c.OsCmd.Path)
+		}
+		return err
 	}
 
-	return c.OsCmd.Run()
+	return c.Wait()
 }
 
-// Start same as (*Cmd).Start() in the os/exec package
+// Start is similar to (*Cmd).Start() in the os/exec package,
+// but verifies the executable before starting it
 func (c *Cmd) Start() error {
-	return c.OsCmd.Start()
+	if c.script != nil {
+		if err := c.prepareScript(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.verify(); err != nil {
+		c.removeScript()
+		return err
+	}
+
+	err := c.OsCmd.Start()
+	if err != nil {
+		c.removeScript()
+	}
+
+	return err
 }
 
 // StderrPipe same as (*Cmd).StderrPipe() in the os/exec package
@@ -127,11 +147,133 @@ func (c *Cmd) String() string {
 }
 
 // Wait is similar to (*Cmd).Wait() in the os/exec package,
-// but deletes the executable at Cmd.Path if c.Cache is false
+// but deletes the bincluded executable at Cmd.Path if c.Cache is false
 func (c *Cmd) Wait() error {
-	if !c.Cache {
+	if c.bincluded && !c.Cache {
 		defer os.Remove(c.OsCmd.Path)
 	}
+	defer c.removeScript()
 
 	return c.OsCmd.Wait()
 }
+
+var (
+	registered   []*binclude.FileSystem
+	registeredMu sync.RWMutex
+)
+
+// Register adds FileSystems to the FileSystems searched by LookPath,
+// FileSystems are searched in the order they were registered.
+func Register(fs ...*binclude.FileSystem) {
+	registeredMu.Lock()
+	registered = append(registered, fs...)
+	registeredMu.Unlock()
+}
+
+// LookPath searches for an executable named name in the registered FileSystems
+// and afterwards in the directories named by the PATH environment variable.
+// The returned Cmd runs the bincluded executable if one was found
+// and the executable on the host otherwise.
+//
+// Inside the FileSystems name may also carry the platform specific suffixes
+// name_GOOS_GOARCH, name_GOOS and .exe on windows.
+// If name contains no slash every directory is searched.
+func LookPath(name string, arg ...string) (*Cmd, error) {
+	return lookPath(nil, name, arg...)
+}
+
+// LookPathContext like LookPath but the returned Cmd
+// is created like CommandContext in the os/exec package.
+func LookPathContext(ctx context.Context, name string, arg ...string) (*Cmd, error) {
+	if ctx == nil {
+		panic("nil Context")
+	}
+
+	return lookPath(ctx, name, arg...)
+}
+
+// lookPath implements LookPath and LookPathContext, ctx may be nil.
+func lookPath(ctx context.Context, name string, arg ...string) (*Cmd, error) {
+	if fs, bincludePath := lookBinclude(name); fs != nil {
+		if ctx == nil {
+			return Command(fs, bincludePath, arg...)
+		}
+		return CommandContext(ctx, fs, bincludePath, arg...)
+	}
+
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, err
+	}
+
+	cmd := Cmd{OsCmd: exec.Command(name, arg...)}
+	if ctx != nil {
+		cmd.OsCmd = exec.CommandContext(ctx, name, arg...)
+	}
+
+	return &cmd, nil
+}
+
+// lookBinclude returns the first registered FileSystem which contains
+// an executable named name and its path inside the FileSystem.
+func lookBinclude(name string) (*binclude.FileSystem, string) {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+
+	for _, fs := range registered {
+		for _, candidate := range candidates(name) {
+			if bincludePath, ok := find(fs, candidate); ok {
+				return fs, bincludePath
+			}
+		}
+	}
+
+	return nil, ""
+}
+
+// candidates returns the names an executable called name
+// can have on the current platform, ordered by specificity.
+func candidates(name string) []string {
+	names := []string{
+		name + "_" + runtime.GOOS + "_" + runtime.GOARCH,
+		name + "_" + runtime.GOOS,
+		name,
+	}
+
+	if runtime.GOOS != "windows" || strings.HasSuffix(name, ".exe") {
+		return names
+	}
+
+	var withExt []string
+	for _, n := range names {
+		withExt = append(withExt, n+".exe", n)
+	}
+
+	return withExt
+}
+
+// find searches fs for a regular file named name, if name contains
+// a slash it is used as the path otherwise all directories are searched.
+func find(fs *binclude.FileSystem, name string) (string, bool) {
+	if strings.Contains(name, "/") {
+		info, err := fs.Stat(name)
+		return name, err == nil && !info.IsDir()
+	}
+
+	fs.RLock()
+	defer fs.RUnlock()
+
+	var paths []string
+	for p, file := range fs.Files {
+		if !file.Mode.IsDir() && path.Base(p) == name {
+			paths = append(paths, p)
+		}
+	}
+
+	if len(paths) == 0 {
+		return "", false
+	}
+
+	sort.Strings(paths)
+
+	return paths[0], true
+}
@@ -1,11 +1,19 @@
 package binexec_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"io/ioutil"
 	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/lu4p/binclude"
 	"github.com/lu4p/binclude/binexec"
 	"github.com/lu4p/binclude/binexec/example"
 )
@@ -102,3 +110,218 @@ func TestRunContext(t *testing.T) {
 		t.Fatal("cannot execute cmd", err)
 	}
 }
+
+func TestIntegrity(t *testing.T) {
+	cmd, err := binexec.Command(BinFS, testprg)
+	if err != nil {
+		t.Fatal("cannot initialize cmd", err)
+	}
+
+	err = ioutil.WriteFile(cmd.OsCmd.Path, []byte("#!/bin/sh\necho replaced"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cmd.Run()
+	if err != binexec.ErrIntegrity {
+		t.Fatal("modified executable was executed:", err)
+	}
+
+	cmd, err = binexec.Command(BinFS, testprg)
+	if err != nil {
+		t.Fatal("cannot initialize cmd", err)
+	}
+
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal("modified executable wasn't replaced", err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on windows")
+	}
+
+	cmd, err := binexec.Command(BinFS, testprg)
+	if err != nil {
+		t.Fatal("cannot initialize cmd", err)
+	}
+	defer os.Remove(cmd.OsCmd.Path)
+
+	info, err := os.Stat(cmd.OsCmd.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o700 {
+		t.Fatal("unexpected permissions:", info.Mode().Perm())
+	}
+}
+
+func TestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := BinFS.ReadFile(testprg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := binexec.Command(BinFS, testprg)
+	if err != nil {
+		t.Fatal("cannot initialize cmd", err)
+	}
+
+	cmd.PublicKey = pub
+	cmd.Signature = ed25519.Sign(priv, content)
+
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal("cannot execute signed cmd", err)
+	}
+
+	cmd, err = binexec.Command(BinFS, testprg)
+	if err != nil {
+		t.Fatal("cannot initialize cmd", err)
+	}
+
+	cmd.PublicKey = pub
+	cmd.Signature = ed25519.Sign(priv, []byte("something else"))
+
+	err = cmd.Run()
+	if err != binexec.ErrIntegrity {
+		t.Fatal("executable with invalid signature was executed:", err)
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	binexec.Register(BinFS)
+
+	cmd, err := binexec.LookPath("testprg")
+	if err != nil {
+		t.Fatal("cannot find bincluded executable", err)
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Dir(cmd.OsCmd.Path) != dir {
+		t.Fatal("executable isn't bincluded:", cmd.OsCmd.Path)
+	}
+
+	var stderr bytes.Buffer
+	cmd.OsCmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal("cannot execute cmd", err)
+	}
+
+	if stderr.String() != "Hello world!\n" {
+		t.Fatal("unexpected output:", stderr.String())
+	}
+
+	_, err = binexec.LookPath("nonexistent")
+	if err == nil {
+		t.Fatal("found nonexistent executable")
+	}
+}
+
+func TestLookPathHost(t *testing.T) {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not in PATH")
+	}
+
+	cmd, err := binexec.LookPathContext(context.Background(), "go", "version")
+	if err != nil {
+		t.Fatal("cannot find executable on the host", err)
+	}
+
+	if cmd.OsCmd.Path != goPath {
+		t.Fatal("unexpected executable:", cmd.OsCmd.Path)
+	}
+
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal("cannot execute cmd", err)
+	}
+
+	_, err = os.Stat(goPath)
+	if err != nil {
+		t.Fatal("executable on the host was removed", err)
+	}
+}
+
+var scriptFS = &binclude.FileSystem{Files: binclude.Files{
+	"scripts/hello.sh": {
+		Filename: "hello.sh", Mode: 0o644,
+		Content: []byte("#!/bin/sh\nread input\necho $input $1\n"),
+	},
+	"scripts/noshebang.sh": {
+		Filename: "noshebang.sh", Mode: 0o644,
+		Content: []byte("echo hello $1\n"),
+	},
+}}
+
+func TestScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("/bin/sh is not available on windows")
+	}
+
+	tests := []struct {
+		path, interpreter string
+		stdin             string
+		want              string
+	}{
+		{path: "scripts/noshebang.sh", interpreter: "/bin/sh", want: "hello world\n"},
+		{path: "scripts/hello.sh", interpreter: "/bin/sh", stdin: "hello", want: "hello world\n"},
+		{path: "scripts/hello.sh", stdin: "hello", want: "hello world\n"},
+	}
+
+	for _, test := range tests {
+		cmd, err := binexec.Script(scriptFS, test.path, test.interpreter, "world")
+		if err != nil {
+			t.Fatal("cannot initialize cmd", err)
+		}
+
+		if test.stdin != "" {
+			cmd.OsCmd.Stdin = strings.NewReader(test.stdin)
+		}
+
+		var stdout bytes.Buffer
+		cmd.OsCmd.Stdout = &stdout
+
+		err = cmd.Run()
+		if err != nil {
+			t.Fatal("cannot execute script", err)
+		}
+
+		if stdout.String() != test.want {
+			t.Fatalf("%s: unexpected output: %q", test.path, stdout.String())
+		}
+
+		for _, arg := range cmd.OsCmd.Args[1:] {
+			if _, err := os.Stat(arg); err == nil {
+				t.Fatal("temporary script wasn't removed:", arg)
+			}
+		}
+	}
+}
+
+func TestScriptNoInterpreter(t *testing.T) {
+	_, err := binexec.Script(scriptFS, "scripts/noshebang.sh", "")
+	if err == nil {
+		t.Fatal("can initialize script without interpreter")
+	}
+
+	_, err = binexec.ScriptContext(context.Background(), scriptFS, "scripts/nonexistent.sh", "/bin/sh")
+	if err == nil {
+		t.Fatal("can initialize nonexistent script")
+	}
+}
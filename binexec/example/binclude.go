@@ -7,3 +7,7 @@ import (
 )
 
 var BinFS = &binclude.FileSystem{Files: binclude.Files{}}
+
+func init() {
+	BinFS.Reindex()
+}
@@ -23,4 +23,5 @@ func init() {
 		BinFS.Files[path] = file
 	}
 	BinFS.Unlock()
+	BinFS.Reindex()
 }
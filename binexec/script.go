@@ -0,0 +1,149 @@
+package binexec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lu4p/binclude"
+)
+
+// stdinArgs the arguments which make an interpreter read the script from stdin,
+// the arguments for the script are appended afterwards.
+var stdinArgs = map[string][]string{
+	"sh":     {"-s", "--"},
+	"bash":   {"-s", "--"},
+	"dash":   {"-s", "--"},
+	"ksh":    {"-s", "--"},
+	"zsh":    {"-s", "--"},
+	"python": {"-"},
+	"node":   {"-"},
+	"perl":   {"-"},
+	"ruby":   {"-"},
+}
+
+// Script returns a Cmd which runs the script at bincludePath with interpreter.
+// If interpreter is empty the interpreter from the shebang line of the script is used.
+//
+// If the interpreter can read scripts from stdin and Cmd.OsCmd.Stdin is not set
+// when the Cmd is started, the script is piped to the interpreter, otherwise
+// the script is written to a temporary file which is removed after the execution.
+func Script(fs *binclude.FileSystem, bincludePath, interpreter string, arg ...string) (*Cmd, error) {
+	return script(nil, fs, bincludePath, interpreter, arg...)
+}
+
+// ScriptContext like Script but the returned Cmd
+// is created like CommandContext in the os/exec package.
+func ScriptContext(ctx context.Context, fs *binclude.FileSystem, bincludePath, interpreter string, arg ...string) (*Cmd, error) {
+	if ctx == nil {
+		panic("nil Context")
+	}
+
+	return script(ctx, fs, bincludePath, interpreter, arg...)
+}
+
+// script implements Script and ScriptContext, ctx may be nil.
+func script(ctx context.Context, fs *binclude.FileSystem, bincludePath, interpreter string, arg ...string) (*Cmd, error) {
+	content, err := fs.ReadFile(bincludePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var interpreterArgs []string
+	if interpreter == "" {
+		interpreter, interpreterArgs = shebang(content)
+		if interpreter == "" {
+			return nil, errors.New("binexec: no interpreter given and " + bincludePath + " has no shebang line")
+		}
+	}
+
+	cmd := Cmd{
+		OsCmd:      exec.Command(interpreter, interpreterArgs...),
+		script:     content,
+		scriptArgs: arg,
+		scriptName: path.Base(bincludePath),
+	}
+	if ctx != nil {
+		cmd.OsCmd = exec.CommandContext(ctx, interpreter, interpreterArgs...)
+	}
+
+	return &cmd, nil
+}
+
+// shebang returns the interpreter and its arguments from the shebang line of a script.
+func shebang(content []byte) (string, []string) {
+	line, _ := bufio.NewReader(bytes.NewReader(content)).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return "", nil
+	}
+
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	return fields[0], fields[1:]
+}
+
+// interpreterName returns the name of the interpreter without version,
+// /usr/bin/env python3 -> python
+func interpreterName(args []string) string {
+	for _, arg := range args {
+		name := strings.TrimSuffix(filepath.Base(arg), ".exe")
+		if name == "env" || strings.HasPrefix(name, "-") {
+			continue
+		}
+
+		return strings.TrimRight(name, "0123456789.")
+	}
+
+	return ""
+}
+
+// prepareScript passes the script to the interpreter via stdin if possible,
+// otherwise the script is written to a temporary file.
+func (c *Cmd) prepareScript() error {
+	if flags, ok := stdinArgs[interpreterName(c.OsCmd.Args)]; ok && c.OsCmd.Stdin == nil {
+		c.OsCmd.Args = append(c.OsCmd.Args, flags...)
+		c.OsCmd.Args = append(c.OsCmd.Args, c.scriptArgs...)
+		c.OsCmd.Stdin = bytes.NewReader(c.script)
+		return nil
+	}
+
+	f, err := ioutil.TempFile("", "binexec-*-"+c.scriptName)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(c.script)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	c.scriptPath = f.Name()
+	c.OsCmd.Args = append(c.OsCmd.Args, c.scriptPath)
+	c.OsCmd.Args = append(c.OsCmd.Args, c.scriptArgs...)
+
+	return nil
+}
+
+// removeScript removes the temporary file created by prepareScript.
+func (c *Cmd) removeScript() {
+	if c.scriptPath == "" {
+		return
+	}
+
+	os.Remove(c.scriptPath)
+	c.scriptPath = ""
+}
@@ -0,0 +1,36 @@
+// Package binload loads Go plugins and WebAssembly modules from a binclude.FileSystem
+package binload
+
+import (
+	"crypto/ed25519"
+	"plugin"
+
+	"github.com/lu4p/binclude"
+	"github.com/lu4p/binclude/internal/cache"
+)
+
+// ErrIntegrity is returned by OpenPlugin and OpenPluginSigned if the cached plugin
+// doesn't match the bincluded file or the supplied signature.
+var ErrIntegrity = cache.ErrIntegrity
+
+// OpenPlugin copies the Go plugin at bincludePath to os.UserCacheDir()
+// and opens it with plugin.Open from the plugin package.
+// The cached plugin is verified against the hash of the bincluded file before it is opened.
+func OpenPlugin(fs *binclude.FileSystem, bincludePath string) (*plugin.Plugin, error) {
+	return OpenPluginSigned(fs, bincludePath, nil, nil)
+}
+
+// OpenPluginSigned like OpenPlugin, but verifies the cached plugin against
+// the ed25519 signature instead of the hash of the bincluded file if publicKey is non-nil.
+func OpenPluginSigned(fs *binclude.FileSystem, bincludePath string, publicKey ed25519.PublicKey, signature []byte) (*plugin.Plugin, error) {
+	cachePath, sum, err := cache.Copy(fs, bincludePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.Verify(cachePath, sum, publicKey, signature); err != nil {
+		return nil, err
+	}
+
+	return plugin.Open(cachePath)
+}
@@ -0,0 +1,90 @@
+package binload_test
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/lu4p/binclude"
+	"github.com/lu4p/binclude/binload"
+)
+
+const pluginSrc = `package main
+
+var Greeting = "Hello plugin!"
+`
+
+// buildPlugin builds a Go plugin and returns a FileSystem containing it as plugin.so
+func buildPlugin(t *testing.T) *binclude.FileSystem {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("plugins are not supported on", runtime.GOOS)
+	}
+
+	dir := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module testplugin\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(pluginSrc), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"build", "-buildmode=plugin", "-o", "plugin.so"}
+	if raceEnabled {
+		args = append(args, "-race")
+	}
+
+	cmd := exec.Command("go", append(args, ".")...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skip("cannot build plugin:", err, string(out))
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "plugin.so"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &binclude.FileSystem{Files: binclude.Files{
+		"plugin.so": {Filename: "plugin.so", Mode: 0o755, Content: content},
+	}}
+}
+
+func TestOpenPlugin(t *testing.T) {
+	fs := buildPlugin(t)
+
+	p, err := binload.OpenPlugin(fs, "plugin.so")
+	if err != nil {
+		t.Fatal("cannot open plugin", err)
+	}
+
+	sym, err := p.Lookup("Greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *sym.(*string) != "Hello plugin!" {
+		t.Fatal("unexpected symbol value:", *sym.(*string))
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = binload.OpenPluginSigned(fs, "plugin.so", pub, ed25519.Sign(priv, []byte("something else")))
+	if err != binload.ErrIntegrity {
+		t.Fatal("plugin with invalid signature was opened:", err)
+	}
+
+	_, err = binload.OpenPlugin(fs, "nonexistent.so")
+	if err == nil {
+		t.Fatal("can open nonexistent plugin")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package binload_test
+
+// raceEnabled the test plugin has to be built with -race too,
+// otherwise it can't be loaded.
+const raceEnabled = true
@@ -0,0 +1,39 @@
+//go:build go1.16
+// +build go1.16
+
+package binload
+
+import (
+	"bytes"
+	"errors"
+	iofs "io/fs"
+
+	"github.com/lu4p/binclude"
+)
+
+// wasmMagic the magic number at the start of every WebAssembly module
+var wasmMagic = []byte("\x00asm")
+
+// WASM returns the WebAssembly module at bincludePath and an io/fs.FS view of fs,
+// which can be handed to a pure Go runtime like wazero:
+//
+//	wasm, fsys, err := binload.WASM(BinFS, "module.wasm")
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//
+//	r := wazero.NewRuntime(ctx)
+//	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+//	_, err = r.InstantiateWithConfig(ctx, wasm, wazero.NewModuleConfig().WithFS(fsys))
+func WASM(fs *binclude.FileSystem, bincludePath string) ([]byte, iofs.FS, error) {
+	wasm, err := fs.ReadFile(bincludePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.HasPrefix(wasm, wasmMagic) {
+		return nil, nil, errors.New("binload: " + bincludePath + " is not a WebAssembly module")
+	}
+
+	return wasm, fs.IOFS(), nil
+}
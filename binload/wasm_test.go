@@ -0,0 +1,42 @@
+//go:build go1.16
+// +build go1.16
+
+package binload_test
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/lu4p/binclude"
+	"github.com/lu4p/binclude/binload"
+)
+
+var wasmFS = &binclude.FileSystem{Files: binclude.Files{
+	"module.wasm": {Filename: "module.wasm", Mode: 0o644, Content: []byte("\x00asm\x01\x00\x00\x00")},
+	"data.txt":    {Filename: "data.txt", Mode: 0o644, Content: []byte("data")},
+}}
+
+func TestWASM(t *testing.T) {
+	wasm, fsys, err := binload.WASM(wasmFS, "module.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(wasm) != "\x00asm\x01\x00\x00\x00" {
+		t.Fatal("unexpected module content")
+	}
+
+	data, err := fs.ReadFile(fsys, "data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "data" {
+		t.Fatal("unexpected file content", string(data))
+	}
+
+	_, _, err = binload.WASM(wasmFS, "data.txt")
+	if err == nil {
+		t.Fatal("non WebAssembly file was accepted")
+	}
+}
@@ -42,3 +42,7 @@ var BinFS = &binclude.FileSystem{Files: binclude.Files{
 		Content: []byte("file.txt"),
 	},
 }}
+
+func init() {
+	BinFS.Reindex()
+}
@@ -2,4 +2,8 @@ module github.com/lu4p/binclude
 
 go 1.15
 
-require github.com/rogpeppe/go-internal v1.7.0
+require (
+	github.com/klauspost/compress v1.15.1
+	github.com/rogpeppe/go-internal v1.7.0
+	gopkg.in/yaml.v2 v2.4.0
+)
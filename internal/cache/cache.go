@@ -0,0 +1,140 @@
+// Package cache copies files from a binclude.FileSystem to the
+// cache directory of the user and verifies them before they are used.
+package cache
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/lu4p/binclude"
+)
+
+// ErrIntegrity is returned by Verify if the file on the host
+// doesn't match the bincluded file or the supplied signature.
+var ErrIntegrity = errors.New("binclude: cached file does not match the bincluded file")
+
+// Copy copies a file from binclude.FileSystem to os.UserCacheDir()
+// and returns the path and the sha256 hash of the copied file.
+// The copied file is only accessible by the owner.
+func Copy(fs *binclude.FileSystem, bincludePath string) (string, [sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", sum, err
+	}
+
+	info, err := fs.Stat(bincludePath)
+	if err != nil {
+		return "", sum, err
+	}
+
+	content, err := fs.ReadFile(bincludePath)
+	if err != nil {
+		return "", sum, err
+	}
+
+	sum = sha256.Sum256(content)
+
+	nanoSec := strconv.Itoa(info.ModTime().Nanosecond())
+
+	namePart := "_" + filepath.Base(bincludePath)
+
+	cachePath := filepath.Join(dir, nanoSec+namePart)
+
+	// exit early if file is already cached and hasn't been modified
+	if isCached(cachePath, sum) {
+		return cachePath, sum, nil
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", sum, err
+	}
+
+	// remove invalidated cache files
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), namePart) {
+			os.Remove(filepath.Join(dir, info.Name())) // don't check for error because we don't really care if the file is removed
+			// no break because there could be multiple cached versions
+		}
+	}
+
+	return cachePath, sum, write(cachePath, content)
+}
+
+// isCached reports whether the file at path is only accessible by the owner
+// and its content matches sum.
+func isCached(path string, sum [sha256.Size]byte) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return false
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	return sha256.Sum256(content) == sum
+}
+
+// write writes content to a temporary file which is only accessible
+// by the owner and renames it to path afterwards, so that a partially written
+// file is never used.
+func write(path string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".binclude-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // noop after a successful rename
+
+	if err := tmp.Chmod(0o700); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Verify checks the file at path against publicKey and signature
+// or against sum if publicKey is nil.
+func Verify(path string, sum [sha256.Size]byte, publicKey ed25519.PublicKey, signature []byte) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if publicKey != nil {
+		if len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, content, signature) {
+			return ErrIntegrity
+		}
+		return nil
+	}
+
+	if sha256.Sum256(content) != sum {
+		return ErrIntegrity
+	}
+
+	return nil
+}
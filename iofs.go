@@ -0,0 +1,159 @@
+//go:build go1.16
+// +build go1.16
+
+package binclude
+
+import (
+	"errors"
+	iofs "io/fs"
+	"path"
+	"strings"
+)
+
+// IOFS returns a view of the FileSystem which implements the io/fs.FS interface.
+func (fs *FileSystem) IOFS() iofs.FS {
+	return ioFS{fs}
+}
+
+// ioFS implements the io/fs.FS interface for a FileSystem.
+type ioFS struct {
+	fs *FileSystem
+}
+
+// check that the io/fs interfaces are implemented
+var (
+	_ iofs.FS          = ioFS{}
+	_ iofs.ReadFileFS  = ioFS{}
+	_ iofs.StatFS      = ioFS{}
+	_ iofs.ReadDirFile = new(File)
+)
+
+// validPath reports whether name is a valid io/fs path, unlike FileSystem.Open
+// the io/fs.FS view doesn't treat backslashes as separators.
+func validPath(name string) bool {
+	return iofs.ValidPath(name) && !strings.Contains(name, "\\")
+}
+
+// Open opens the named file, name must be a valid io/fs path.
+func (f ioFS) Open(name string) (iofs.File, error) {
+	if !validPath(name) {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrInvalid}
+	}
+
+	return f.fs.Open(name)
+}
+
+// ReadFile reads the named file and returns its contents.
+func (f ioFS) ReadFile(name string) ([]byte, error) {
+	if !validPath(name) {
+		return nil, &iofs.PathError{Op: "readfile", Path: name, Err: iofs.ErrInvalid}
+	}
+
+	return f.fs.ReadFile(name)
+}
+
+// Stat returns a FileInfo describing the named file.
+func (f ioFS) Stat(name string) (iofs.FileInfo, error) {
+	if !validPath(name) {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: iofs.ErrInvalid}
+	}
+
+	return f.fs.Stat(name)
+}
+
+// ReadDir reads the contents of the directory associated with file like Readdir,
+// but returns io/fs.DirEntry values and fails if the file is not a directory.
+func (f *File) ReadDir(count int) ([]iofs.DirEntry, error) {
+	if !f.Mode.IsDir() {
+		return nil, &iofs.PathError{Op: "readdir", Path: f.path, Err: errors.New("not a directory")}
+	}
+
+	infos, err := f.Readdir(count)
+
+	entries := make([]iofs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = dirEntry{info}
+	}
+
+	return entries, err
+}
+
+// WalkDir walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root. The files are walked in lexical order.
+// WalkDir has the same semantics as fs.WalkDir from the io/fs package including fs.SkipDir.
+func (fs *FileSystem) WalkDir(root string, fn iofs.WalkDirFunc) error {
+	info, err := fs.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = fs.walkDir(root, dirEntry{info}, fn)
+	}
+
+	if err == iofs.SkipDir {
+		return nil
+	}
+
+	return err
+}
+
+// walkDir recursively descends name, calling fn.
+func (fs *FileSystem) walkDir(name string, d iofs.DirEntry, fn iofs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == iofs.SkipDir && d.IsDir() {
+			// Successfully skipped directory.
+			err = nil
+		}
+		return err
+	}
+
+	infos, err := fs.ReadDir(name)
+	if err != nil {
+		// Second call, to report ReadDir error.
+		err = fn(name, d, err)
+		if err != nil {
+			if err == iofs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, info := range infos {
+		if err := fs.walkDir(path.Join(name, info.Name()), dirEntry{info}, fn); err != nil {
+			if err == iofs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dirEntry implements the io/fs.DirEntry interface for a FileInfo.
+type dirEntry struct {
+	info iofs.FileInfo
+}
+
+// check that the io/fs.DirEntry interface is implemented
+var _ iofs.DirEntry = dirEntry{}
+
+// Name returns the base name of the file
+func (d dirEntry) Name() string {
+	return d.info.Name()
+}
+
+// IsDir abbreviation for Type().IsDir()
+func (d dirEntry) IsDir() bool {
+	return d.info.IsDir()
+}
+
+// Type returns the type bits of the file mode
+func (d dirEntry) Type() iofs.FileMode {
+	return d.info.Mode().Type()
+}
+
+// Info returns the FileInfo of the file
+func (d dirEntry) Info() (iofs.FileInfo, error) {
+	return d.info, nil
+}
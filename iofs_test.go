@@ -0,0 +1,42 @@
+//go:build go1.16
+// +build go1.16
+
+package binclude_test
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIOFS(t *testing.T) {
+	err := fstest.TestFS(BinFS.IOFS(), "file.txt", "assets/asset1.txt", "assets/subdir/subdirasset2.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	var paths []string
+	err := BinFS.WalkDir("assets", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Name() == "subdir" {
+			return fs.SkipDir
+		}
+
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"assets", "assets/asset1.txt", "assets/asset2.txt", "assets/logo_nocompress.png"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v want %v", paths, want)
+	}
+}
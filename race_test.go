@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package binclude_test
+
+// raceEnabled the race detector makes decompressing large files too slow.
+const raceEnabled = true
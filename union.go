@@ -0,0 +1,167 @@
+package binclude
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Union mounts multiple FileSystems, e.g. from different packages,
+// at different prefixes and merges them into a single FileSystem.
+//
+// If multiple FileSystems contain the same path the following rules apply:
+//   - a FileSystem mounted at a longer prefix wins over one mounted at a shorter prefix
+//   - for equal prefixes the FileSystem mounted first wins
+//   - directories are merged, a file which wins over a directory hides the whole directory
+//   - mount points and their parents are always directories
+//
+// The FileSystems are merged on the first use after Mount was called,
+// files added to a mounted FileSystem afterwards are not visible.
+// The zero value is an empty Union ready to use.
+type Union struct {
+	mounts []unionMount
+	merged *FileSystem
+	mu     sync.Mutex
+}
+
+// unionMount a FileSystem mounted at prefix
+type unionMount struct {
+	prefix string
+	fs     *FileSystem
+}
+
+// check that the http.FileSystem interface is implemented
+var _ http.FileSystem = new(Union)
+
+// Mount mounts fs at prefix, the prefix "." or "/" mounts fs at the root.
+// The prefix is cleaned like paths passed to Open.
+func (u *Union) Mount(prefix string, fs *FileSystem) error {
+	cleaned, ok := CleanPath(prefix)
+	if !ok {
+		return &os.PathError{Op: "mount", Path: prefix, Err: os.ErrInvalid}
+	}
+
+	u.mu.Lock()
+	u.mounts = append(u.mounts, unionMount{prefix: cleaned, fs: fs})
+	u.merged = nil
+	u.mu.Unlock()
+
+	return nil
+}
+
+// FileSystem returns the merged FileSystem of all mounted FileSystems.
+func (u *Union) FileSystem() *FileSystem {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.merged == nil {
+		u.merged = u.merge()
+	}
+
+	return u.merged
+}
+
+// Open returns the File at name from the merged FileSystem.
+func (u *Union) Open(name string) (http.File, error) {
+	return u.FileSystem().Open(name)
+}
+
+// Stat returns a FileInfo describing the named file from the merged FileSystem.
+func (u *Union) Stat(name string) (os.FileInfo, error) {
+	return u.FileSystem().Stat(name)
+}
+
+// ReadFile reads the file named by filename from the merged FileSystem.
+func (u *Union) ReadFile(filename string) ([]byte, error) {
+	return u.FileSystem().ReadFile(filename)
+}
+
+// ReadDir reads the directory named by dirname from the merged FileSystem
+// and returns a list of directory entries sorted by filename.
+func (u *Union) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return u.FileSystem().ReadDir(dirname)
+}
+
+// merge merges all mounted FileSystems according to the rules documented on Union.
+func (u *Union) merge() *FileSystem {
+	order := make([]int, len(u.mounts))
+	for i := range order {
+		order[i] = i
+	}
+
+	// FileSystems are merged from the lowest to the highest priority,
+	// so that files with a higher priority overwrite files with a lower priority
+	sort.Slice(order, func(i, j int) bool {
+		a, b := u.mounts[order[i]], u.mounts[order[j]]
+		if depth(a.prefix) != depth(b.prefix) {
+			return depth(a.prefix) < depth(b.prefix)
+		}
+		return order[i] > order[j]
+	})
+
+	merged := &FileSystem{Files: make(Files)}
+	for _, i := range order {
+		m := u.mounts[i]
+
+		mountDir(merged, m.prefix)
+
+		m.fs.RLock()
+		for name, file := range m.fs.Files {
+			if name == "." {
+				continue
+			}
+
+			name = path.Join(m.prefix, name)
+			mountDir(merged, path.Dir(name))
+
+			if existing, ok := merged.Files[name]; ok && existing.Mode.IsDir() && !file.Mode.IsDir() {
+				removeAll(merged, name)
+			}
+
+			merged.Files[name] = file
+		}
+		m.fs.RUnlock()
+	}
+
+	return merged
+}
+
+// depth returns the number of path elements of a cleaned path.
+func depth(name string) int {
+	if name == "." {
+		return 0
+	}
+
+	return strings.Count(name, "/") + 1
+}
+
+// mountDir makes sure that dir and all its parents are directories.
+func mountDir(fs *FileSystem, dir string) {
+	for dir != "." {
+		if existing, ok := fs.Files[dir]; ok && existing.Mode.IsDir() {
+			return
+		}
+
+		removeAll(fs, dir)
+		fs.Files[dir] = &File{
+			Filename: path.Base(dir),
+			Mode:     os.ModeDir | os.ModePerm,
+		}
+
+		dir = path.Dir(dir)
+	}
+}
+
+// removeAll removes name and all files below name.
+func removeAll(fs *FileSystem, name string) {
+	delete(fs.Files, name)
+
+	for other := range fs.Files {
+		if strings.HasPrefix(other, name+"/") {
+			delete(fs.Files, other)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package binclude
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// zipComment prefixes the comment of archives appended by AppendZip,
+// it is followed by the size of the file before the archive was appended.
+const zipComment = "binclude offset "
+
+// lazyContent the content of a file in a zip archive, which is read on first use.
+// It is shared by all copies of the File returned by Open.
+type lazyContent struct {
+	once    sync.Once
+	zf      *zip.File
+	content []byte
+	err     error
+}
+
+// load reads the content of a file from a zip archive,
+// it does nothing for files whose content is in memory.
+func (f *File) load() error {
+	if f.lazy == nil {
+		return nil
+	}
+
+	f.lazy.once.Do(func() {
+		rc, err := f.lazy.zf.Open()
+		if err == io.EOF {
+			// the archive was truncated, Read must not report an empty file
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			f.lazy.err = err
+			return
+		}
+		defer rc.Close()
+
+		f.lazy.content, f.lazy.err = ioutil.ReadAll(rc)
+	})
+
+	if f.lazy.err == nil {
+		f.Content = f.lazy.content
+	}
+
+	return f.lazy.err
+}
+
+// lazyReader reads the content of an opened File from a zip archive on first use,
+// so opening a File for Stat or Readdir doesn't read it.
+type lazyReader struct {
+	file   *File
+	reader *bytes.Reader
+}
+
+func (r *lazyReader) load() error {
+	if r.reader != nil {
+		return nil
+	}
+
+	if err := r.file.load(); err != nil {
+		return err
+	}
+
+	r.reader = bytes.NewReader(r.file.Content)
+	return nil
+}
+
+// Read implements the io.Reader interface.
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if err := r.load(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
+
+// Seek implements the io.Seeker interface.
+func (r *lazyReader) Seek(offset int64, whence int) (int64, error) {
+	if err := r.load(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Seek(offset, whence)
+}
+
+// OpenExecutable returns the FileSystem appended to the running executable
+// with AppendZip or `binclude append`. The files are read from the executable
+// on first use, so the executable stays open.
+func OpenExecutable() (*FileSystem, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenZip(exe)
+}
+
+// OpenZip returns a FileSystem with the files of the zip archive at name,
+// the archive can be appended to another file like an executable.
+// The files are read on first use, so the file stays open.
+func OpenZip(name string) (*FileSystem, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("no zip archive in %s: %v", name, err)
+	}
+
+	fs := &FileSystem{Files: make(Files)}
+	for _, zf := range zr.File {
+		key, ok := CleanPath(zf.Name)
+		if !ok || key == "." {
+			continue
+		}
+
+		file := &File{
+			Filename: path.Base(key),
+			Mode:     zf.Mode(),
+			ModTime:  zf.Modified,
+		}
+
+		if !zf.Mode().IsDir() {
+			file.lazy = &lazyContent{zf: zf}
+		}
+
+		fs.Files[key] = file
+	}
+	fs.Reindex()
+
+	return fs, nil
+}
+
+// AppendZip appends all files of the FileSystem as a zip archive to the file at name,
+// usually an executable which reads them with OpenExecutable. The offsets in the
+// archive are relative to the start of the file, so it can be read with archive/zip.
+// An archive appended by AppendZip before is replaced, files which already end
+// with another zip archive are rejected.
+func (fs *FileSystem) AppendZip(name string) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	offset, err := appendOffset(f, info.Size())
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("cannot append to %s: %v", name, err)
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	zw := zip.NewWriter(f)
+	zw.SetOffset(offset)
+	if err := zw.SetComment(zipComment + strconv.FormatInt(offset, 10)); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := fs.writeZip(zw, "."); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// appendOffset returns the offset at which AppendZip writes the archive into f of size,
+// the start of an archive appended before or the end of f.
+func appendOffset(f *os.File, size int64) (int64, error) {
+	zr, err := zip.NewReader(f, size)
+	if err == zip.ErrFormat {
+		return size, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !strings.HasPrefix(zr.Comment, zipComment) {
+		return 0, errors.New("already contains a zip archive")
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimPrefix(zr.Comment, zipComment), 10, 64)
+	if err != nil || offset < 0 || offset > size {
+		return 0, errors.New("invalid offset of the appended zip archive: " + zr.Comment)
+	}
+
+	return offset, nil
+}